@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/touken928/gitlite/internal/auth"
+	"github.com/touken928/gitlite/internal/backup"
+	"github.com/touken928/gitlite/internal/config"
+	"github.com/touken928/gitlite/internal/repo"
+)
+
+// usage describes the subcommands of the gitlite binary
+const usage = `Usage:
+  gitlite                            Run the server
+  gitlite backup [file]              Write a backup of the data directory
+  gitlite restore [--check] <file>   Replace the data directory with a backup
+`
+
+// runCommand runs a subcommand of the gitlite binary and returns its exit code
+func runCommand(cfg *config.Config, args []string) int {
+	var err error
+	switch args[0] {
+	case "backup":
+		err = runBackup(cfg, args[1:])
+	case "restore":
+		err = runRestore(cfg, args[1:])
+	case "help", "-h", "--help":
+		fmt.Print(usage)
+		return 0
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		return 1
+	}
+	return 0
+}
+
+// runBackup writes a backup from the files in the data directory. Writes
+// of a running server are not fenced, so online backups should use the
+// admin backup command instead.
+func runBackup(cfg *config.Config, args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: gitlite backup [file]")
+	}
+	path := backup.DefaultPath(cfg.DataPath, time.Now())
+	if len(args) == 1 {
+		path = args[0]
+	}
+
+	authMgr := auth.NewManager()
+	if err := authMgr.LoadFromFile(filepath.Join(cfg.DataPath, "users.json")); err != nil {
+		return err
+	}
+	repoMgr := repo.NewManager(cfg.DataPath)
+	if err := repoMgr.LoadFromFile(filepath.Join(cfg.DataPath, "repos.json")); err != nil {
+		return err
+	}
+
+	manifest, err := backup.CreateFile(path, cfg.DataPath, authMgr, repoMgr)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Backup of %d users and %d repositories written to %s\n", manifest.Users, len(manifest.Repos), path)
+	return nil
+}
+
+// runRestore checks a backup and, unless only checking, replaces the data
+// directory with it. The server must be stopped.
+func runRestore(cfg *config.Config, args []string) error {
+	check := len(args) == 2 && args[0] == "--check"
+	if check {
+		args = args[1:]
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("usage: gitlite restore [--check] <file>")
+	}
+
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if check {
+		manifest, err := backup.Verify(f)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Backup from %s with %d users and %d repositories is valid\n",
+			manifest.CreatedAt.Local().Format("2006-01-02 15:04"), manifest.Users, len(manifest.Repos))
+		return nil
+	}
+
+	manifest, previous, err := backup.Restore(f, cfg.DataPath)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored backup from %s with %d users and %d repositories\n",
+		manifest.CreatedAt.Local().Format("2006-01-02 15:04"), manifest.Users, len(manifest.Repos))
+	if previous != "" {
+		fmt.Printf("Previous data moved to %s\n", previous)
+	}
+	return nil
+}
@@ -6,10 +6,10 @@ require (
 	github.com/gliderlabs/ssh v0.3.7
 	go.uber.org/zap v1.27.1
 	golang.org/x/crypto v0.28.0
+	golang.org/x/sys v0.26.0
 )
 
 require (
 	github.com/anmitsu/go-shlex v0.0.0-20200514113438-38f4b401e2be // indirect
 	go.uber.org/multierr v1.10.0 // indirect
-	golang.org/x/sys v0.26.0 // indirect
 )
@@ -1,55 +1,140 @@
 package admin
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"net"
+	"os"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/touken928/gitlite/internal/audit"
 	"github.com/touken928/gitlite/internal/auth"
+	"github.com/touken928/gitlite/internal/backup"
+	"github.com/touken928/gitlite/internal/dto"
 	"github.com/touken928/gitlite/internal/i18n"
+	"github.com/touken928/gitlite/internal/lfs"
+	"github.com/touken928/gitlite/internal/logging"
 	"github.com/touken928/gitlite/internal/repo"
+	"github.com/touken928/gitlite/internal/service"
 
 	"github.com/gliderlabs/ssh"
+	"go.uber.org/zap"
 	gossh "golang.org/x/crypto/ssh"
 )
 
 // TUI provides an interactive command-line interface for server administration
 type TUI struct {
-	authMgr  auth.AuthManager      // User authentication manager interface
-	repoMgr  repo.RepoManager      // Repository manager interface
-	dataPath string                // Base directory for data storage
-	sess     ssh.Session           // SSH session for I/O
-	msg      i18n.Messages         // Localized messages
+	authMgr     auth.AuthManager      // User authentication manager interface
+	repoMgr     repo.RepoManager      // Repository manager interface
+	tokens      *auth.TokenManager    // HTTP API tokens
+	dataPath    string                // Base directory for data storage
+	sess        ssh.Session           // SSH session for I/O
+	msg         i18n.Messages         // Localized messages
+	lang        string                // Language code of msg
+	actor       string                // Administrator recorded as the author of changes
+	svc         *service.Service      // Cross-manager operations
+	interactive bool                  // Whether the session is the interactive TUI on a terminal
+	status      int                   // Exit status of the last command
+	jsonOutput  bool                  // Whether every command answers in JSON
+	response    *response             // JSON response of the running command, nil for text output
+	editor      *lineEditor           // Line editor of the interactive TUI, created on first use
+}
+
+// Formats used to show and parse dates in the TUI
+const (
+	dateFormat = "2006-01-02"
+	timeFormat = "2006-01-02 15:04"
+)
+
+// parseExpiry parses the date of an --expires option. What expires on a
+// day stays valid until the end of it in the server's time zone, so the
+// last nanosecond of the day is returned.
+func parseExpiry(s string) (time.Time, error) {
+	day, err := time.ParseInLocation(dateFormat, s, time.Local)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return day.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
 }
 
 // New creates a new admin TUI instance
-func New(authMgr auth.AuthManager, repoMgr repo.RepoManager, dataPath string) *TUI {
+func New(authMgr auth.AuthManager, repoMgr repo.RepoManager, tokens *auth.TokenManager, dataPath string) *TUI {
 	return &TUI{
 		authMgr:  authMgr,
 		repoMgr:  repoMgr,
+		tokens:   tokens,
 		dataPath: dataPath,
-		msg:      i18n.GetMessages("en"),
+		msg:      i18n.GetMessages(i18n.DefaultLang),
+		lang:     i18n.DefaultLang,
+		actor:    "admin",
+		svc:      service.New(authMgr, repoMgr),
 	}
 }
 
+// SetActor sets the administrator recorded as the author of changes
+func (t *TUI) SetActor(name string) {
+	t.actor = name
+}
+
+// SetLang sets the display language the session starts with
+func (t *TUI) SetLang(lang string) {
+	t.setLang(lang)
+}
+
 // setLang switches the display language
 func (t *TUI) setLang(lang string) {
+	if !i18n.Supported(lang) {
+		lang = i18n.DefaultLang
+	}
 	t.msg = i18n.GetMessages(lang)
+	t.lang = lang
+}
+
+// saveLang remembers the language of the administrator for later
+// sessions, empty follows the SSH locale
+func (t *TUI) saveLang(lang string) {
+	if t.authMgr.GetAdmin(t.actor) != nil {
+		if err := t.authMgr.SetAdminLang(t.actor, lang); err != nil {
+			t.failErr(err)
+			return
+		}
+		t.saveAdmins()
+		return
+	}
+	// Users with the admin role keep their language with the user
+	if err := t.authMgr.SetUserLang(t.actor, lang); err != nil {
+		t.failErr(err)
+		return
+	}
+	t.saveData()
 }
 
 // saveData persists user and repository data to disk
 func (t *TUI) saveData() {
 	if err := t.authMgr.SaveToFile(t.dataPath + "/users.json"); err != nil {
-		t.writeln(t.msg.SaveUserDataFailed + err.Error())
+		t.fail(codeSaveFailed, t.msg.SaveUserDataFailed + err.Error())
 	}
 	if err := t.repoMgr.SaveToFile(t.dataPath + "/repos.json"); err != nil {
-		t.writeln(t.msg.SaveRepoDataFailed + err.Error())
+		t.fail(codeSaveFailed, t.msg.SaveRepoDataFailed + err.Error())
 	}
 }
 
+// Exit statuses of non-interactive commands
+const (
+	exitOK     = 0 // Command succeeded
+	exitFailed = 1 // Command was understood but failed
+	exitUsage  = 2 // Command or its arguments were not understood
+)
+
 // Run starts the admin TUI main loop
 func (t *TUI) Run(sess ssh.Session) {
 	t.sess = sess
+	t.interactive = true
 	t.writeln("")
 	t.writeln("╔══════════════════════════════════════╗")
 	t.writeln("║     Git Server Management System     ║")
@@ -58,100 +143,326 @@ func (t *TUI) Run(sess ssh.Session) {
 	t.showHelp()
 
 	for {
-		t.write("\r\nadmin> ")
-		line, err := t.readLine()
+		t.write("\r\n")
+		line, err := t.readCommand()
 		if err != nil {
 			return
 		}
 
-		line = strings.TrimSpace(line)
-		if line == "" {
+		args := strings.Fields(line)
+		if len(args) == 0 {
 			continue
 		}
+		if !t.execute(args) {
+			return
+		}
+	}
+}
+
+// Exec runs a single command, such as "ssh host user create bob", and
+// returns its exit status. With a terminal ("ssh -t") it behaves like the TUI.
+func (t *TUI) Exec(sess ssh.Session, args []string) int {
+	t.sess = sess
+	_, _, t.interactive = sess.Pty()
+	t.execute(args)
+	return t.status
+}
+
+// RunBatch runs commands read line by line from the session, skipping
+// blank lines and "#" comments. It stops at the first failing command and
+// returns its exit status.
+func (t *TUI) RunBatch(sess ssh.Session) int {
+	t.sess = sess
+	for {
+		line, err := t.readLine("")
+		if err != nil {
+			return exitOK
+		}
 
 		args := strings.Fields(line)
-		cmd := args[0]
-		args = args[1:]
-
-		switch cmd {
-		case "help", "h":
-			t.showHelp()
-		case "lang":
-			t.handleLang(args)
-		case "quit", "exit", "q":
+		if len(args) == 0 || strings.HasPrefix(args[0], "#") {
+			continue
+		}
+		if !t.execute(args) || t.status != exitOK {
+			return t.status
+		}
+	}
+}
+
+// execute runs one command and records its exit status. It returns false
+// when the session should end.
+func (t *TUI) execute(args []string) bool {
+	t.status = exitOK
+	args, jsonFlag := cutFlag(args, "--json")
+	if len(args) == 0 {
+		t.usage(t.msg.UnknownCommand)
+		return true
+	}
+	if t.jsonOutput || jsonFlag {
+		t.response = &response{Command: commandName(args)}
+		defer t.writeResponse()
+	}
+	cmd := args[0]
+	args = args[1:]
+
+	switch cmd {
+	case "help", "h":
+		t.showHelp()
+	case "lang":
+		t.handleLang(args)
+	case "output":
+		t.handleOutput(args)
+	case "quit", "exit", "q":
+		if t.interactive {
 			t.writeln("Bye!")
-			return
-		case "repo":
-			t.handleRepo(args)
-		case "user":
-			t.handleUser(args)
-		default:
-			t.writeln(t.msg.UnknownCommand + cmd)
 		}
+		return false
+	case "repo":
+		t.handleRepo(args)
+	case "user":
+		t.handleUser(args)
+	case "fsck":
+		t.handleFsck(args)
+	case "backup":
+		t.handleBackup(args)
+	case "token":
+		t.handleToken(args)
+	case "admin":
+		t.handleAdmin(args)
+	default:
+		t.fail(codeUnknownCommand, t.msg.UnknownCommand + cmd)
+	}
+	t.audit(cmd, args)
+	return true
+}
+
+// unaudited lists the commands that only affect the session and are not audited
+var unaudited = map[string]bool{"help": true, "h": true, "lang": true, "output": true}
+
+// audit records a command, who ran it and whether it succeeded in the
+// audit log and the server log
+func (t *TUI) audit(cmd string, args []string) {
+	if unaudited[cmd] {
+		return
+	}
+	command := strings.Join(append([]string{cmd}, args...), " ")
+	ok := t.status == exitOK
+	logging.Get().Info("Admin command",
+		zap.String("admin", t.actor), zap.String("command", command), zap.Bool("ok", ok))
+
+	remote, _, _ := net.SplitHostPort(t.sess.RemoteAddr().String())
+	entry := audit.Entry{Actor: t.actor, Via: "ssh", Remote: remote, Command: command, OK: ok}
+	if err := audit.Record(t.dataPath, entry); err != nil {
+		logging.Get().Warn("Failed to write audit log", zap.Error(err))
 	}
 }
 
-// write sends a string to the SSH session
+// write sends a string to the SSH session. Text output is dropped while a
+// JSON response is being built.
 func (t *TUI) write(s string) {
+	if t.response != nil {
+		return
+	}
 	io.WriteString(t.sess, s)
 }
 
-// writeln sends a string with newline to the SSH session
+// writeln sends a string with newline to the SSH session. Terminals get
+// CRLF line endings, scripts plain line feeds.
 func (t *TUI) writeln(s string) {
-	io.WriteString(t.sess, s+"\r\n")
+	if t.response != nil {
+		return
+	}
+	if t.interactive {
+		io.WriteString(t.sess, s+"\r\n")
+	} else {
+		io.WriteString(t.sess, s+"\n")
+	}
+}
+
+// fail reports a failed command with one of the codeXxx error codes.
+// Outside the interactive TUI the message goes to stderr.
+func (t *TUI) fail(code, s string) {
+	t.status = exitStatus(code)
+	if t.response != nil {
+		t.response.Error = &responseError{Code: code, Message: s}
+		return
+	}
+	t.writeErr(s)
+}
+
+// failErr reports a command that failed with an error from a manager.
+// Refusals of the service layer are shown with their localized message.
+func (t *TUI) failErr(err error) {
+	switch {
+	case errors.Is(err, service.ErrGuestReadOnly):
+		t.fail(codeGuestReadOnly, t.msg.GuestReadOnly)
+		return
+	case errors.Is(err, service.ErrKeyInUse):
+		t.fail(codeKeyInUse, t.msg.KeyInUse)
+		return
+	case errors.Is(err, auth.ErrTokenNotFound):
+		t.fail(codeTokenNotFound, t.msg.TokenNotFound)
+		return
+	case errors.Is(err, auth.ErrLastAdmin):
+		t.fail(codeLastAdmin, t.msg.LastAdmin)
+		return
+	}
+	if t.response != nil {
+		t.fail(errorCode(err), err.Error())
+		return
+	}
+	t.fail(errorCode(err), t.msg.Error+err.Error())
+}
+
+// usage reports a command that was not understood, along with its usage
+func (t *TUI) usage(s string) {
+	t.fail(codeUsage, s)
+}
+
+// result sets the data of the JSON response of the running command
+func (t *TUI) result(data any) {
+	if t.response != nil {
+		t.response.Data = data
+	}
+}
+
+// writeErr writes an error message to the terminal or, for scripts, to stderr
+func (t *TUI) writeErr(s string) {
+	if t.interactive {
+		t.writeln(s)
+		return
+	}
+	io.WriteString(t.sess.Stderr(), s+"\n")
 }
 
-// readLine reads a line from the SSH session with basic line editing
-func (t *TUI) readLine() (string, error) {
+// output returns a writer for command output such as git progress,
+// translating line endings for terminals
+func (t *TUI) output() io.Writer {
+	if t.response != nil {
+		return io.Discard
+	}
+	if t.interactive {
+		return crlfWriter{t.sess}
+	}
+	return t.sess
+}
+
+// readLine shows prompt and reads a line from the SSH session. The
+// interactive TUI edits it with the line editor; scripts are read as is,
+// without echo.
+func (t *TUI) readLine(prompt string) (string, error) {
+	if t.interactive {
+		return t.lineEditor().readLine(prompt, false)
+	}
+	t.write(prompt)
+
 	var line []byte
 	buf := make([]byte, 1)
-
 	for {
 		n, err := t.sess.Read(buf)
 		if err != nil || n == 0 {
+			// A last line without a line ending still counts
+			if err == io.EOF && len(line) > 0 {
+				return string(line), nil
+			}
 			return "", err
 		}
-
-		ch := buf[0]
-		switch ch {
-		case '\r', '\n':
-			t.write("\r\n")
+		switch buf[0] {
+		case '\n':
 			return string(line), nil
-		case 127, '\b': // Backspace
-			if len(line) > 0 {
-				line = line[:len(line)-1]
-				t.write("\b \b")
-			}
-		case 3: // Ctrl+C - interrupt
-			t.write("^C\r\n")
-			return "", io.EOF
-		case 4: // Ctrl+D - EOF
-			if len(line) == 0 {
-				return "", io.EOF
-			}
+		case '\r':
 		default:
-			if ch >= 32 && ch < 127 {
-				line = append(line, ch)
-				t.sess.Write([]byte{ch})
-			}
+			line = append(line, buf[0])
 		}
 	}
 }
 
+// readCommand reads a command at the TUI prompt with history and tab
+// completion, and records it in the history of the administrator
+func (t *TUI) readCommand() (string, error) {
+	e := t.lineEditor()
+	entries := len(e.history)
+	line, err := e.readLine("admin> ", true)
+	if err != nil {
+		return "", err
+	}
+	if len(e.history) > entries {
+		appendHistory(t.historyPath(), e.history[len(e.history)-1])
+	}
+	return line, nil
+}
+
+// lineEditor returns the line editor of the session, creating it on first
+// use with the history of the administrator
+func (t *TUI) lineEditor() *lineEditor {
+	if t.editor != nil {
+		return t.editor
+	}
+	pty, winCh, _ := t.sess.Pty()
+	e := newLineEditor(t.sess, t.sess, pty.Window.Width)
+	e.history = loadHistory(t.historyPath())
+	e.complete = t.completeArgs
+	if winCh != nil {
+		go func() {
+			for win := range winCh {
+				e.setWidth(win.Width)
+			}
+		}()
+	}
+	t.editor = e
+	return e
+}
+
 // showHelp displays available commands
 func (t *TUI) showHelp() {
 	help := t.msg.HelpRepoList + "\n" +
 		t.msg.HelpRepoCreate + "\n" +
+		t.msg.HelpRepoTemplates + "\n" +
 		t.msg.HelpRepoDelete + "\n" +
 		t.msg.HelpRepoAddUser + "\n" +
 		t.msg.HelpRepoDelUser + "\n" +
+		t.msg.HelpRepoInfo + "\n" +
+		t.msg.HelpRepoQuota + "\n" +
+		t.msg.HelpRepoMaxBlob + "\n" +
+		t.msg.HelpRepoLfs + "\n" +
+		t.msg.HelpRepoLfsGC + "\n" +
+		t.msg.HelpRepoGC + "\n" +
+		t.msg.HelpRepoFsck + "\n" +
+		t.msg.HelpRepoAddKey + "\n" +
+		t.msg.HelpRepoDelKey + "\n" +
+		t.msg.HelpRepoKeys + "\n" +
+		t.msg.HelpRepoScan + "\n" +
+		t.msg.HelpRepoImport + "\n" +
+		t.msg.HelpRepoTrash + "\n" +
+		t.msg.HelpRepoRestore + "\n" +
+		t.msg.HelpRepoPurge + "\n" +
+		t.msg.HelpRepoRename + "\n" +
+		t.msg.HelpRepoFork + "\n" +
+		t.msg.HelpRepoSet + "\n" +
+		t.msg.HelpRepoArchive + "\n" +
+		t.msg.HelpRepoUnarchive + "\n" +
 		t.msg.HelpUserList + "\n" +
 		t.msg.HelpUserCreate + "\n" +
 		t.msg.HelpUserDelete + "\n" +
 		t.msg.HelpUserAddKey + "\n" +
 		t.msg.HelpUserDelKey + "\n" +
 		t.msg.HelpUserKeys + "\n" +
+		t.msg.HelpUserExpireKey + "\n" +
+		t.msg.HelpUserStaleKeys + "\n" +
+		t.msg.HelpFsck + "\n" +
+		t.msg.HelpBackup + "\n" +
+		t.msg.HelpTokenList + "\n" +
+		t.msg.HelpTokenCreate + "\n" +
+		t.msg.HelpTokenRevoke + "\n" +
+		t.msg.HelpAdminList + "\n" +
+		t.msg.HelpAdminAdd + "\n" +
+		t.msg.HelpAdminDelKey + "\n" +
+		t.msg.HelpAdminRemove + "\n" +
+		t.msg.HelpUserQuota + "\n" +
+		t.msg.HelpUserRole + "\n" +
 		t.msg.HelpLang + "\n" +
+		t.msg.HelpOutput + "\n" +
+		t.msg.HelpConfirm + "\n" +
 		t.msg.HelpHelp + "\n" +
 		t.msg.HelpQuit + "\n\n" +
 		t.msg.HelpNote
@@ -161,31 +472,63 @@ func (t *TUI) showHelp() {
 // handleLang processes the language switching command
 func (t *TUI) handleLang(args []string) {
 	if len(args) == 0 {
-		t.writeln(t.msg.CurrentLang + t.msg.CurrentLang[:len(t.msg.CurrentLang)-1])
+		t.writeln(t.msg.CurrentLang + t.lang)
 		return
 	}
-	switch args[0] {
-	case "zh":
-		t.setLang("zh")
-		t.writeln(t.msg.LangSwitched)
-	case "en":
-		t.setLang("en")
+	switch {
+	case args[0] == "auto":
+		t.setLang(i18n.FromEnv(t.sess.Environ()))
+		t.saveLang("")
+		t.writeln(t.msg.LangAuto)
+	case i18n.Supported(args[0]):
+		t.setLang(args[0])
+		t.saveLang(args[0])
 		t.writeln(t.msg.LangSwitched)
 	default:
-		t.writeln(t.msg.LangUsage)
+		t.usage(t.msg.LangUsage + " (" + strings.Join(i18n.Languages(), ", ") + ")")
+	}
+}
+
+// handleOutput switches the session between text and JSON output
+func (t *TUI) handleOutput(args []string) {
+	if len(args) != 1 || (args[0] != "text" && args[0] != "json") {
+		t.usage(t.msg.OutputUsage)
+		return
+	}
+	t.jsonOutput = args[0] == "json"
+	t.writeln(fmt.Sprintf(t.msg.OutputSwitched, args[0]))
+}
+
+// cutFlag removes every occurrence of flag from args and reports whether it was present
+func cutFlag(args []string, flag string) ([]string, bool) {
+	rest := make([]string, 0, len(args))
+	found := false
+	for _, a := range args {
+		if a == flag {
+			found = true
+			continue
+		}
+		rest = append(rest, a)
 	}
+	return rest, found
 }
 
 // handleRepo processes repository management commands
 func (t *TUI) handleRepo(args []string) {
 	if len(args) == 0 {
-		t.writeln(t.msg.RepoUsage)
+		t.usage(t.msg.RepoUsage)
 		return
 	}
 
 	switch args[0] {
 	case "list":
 		repos := t.repoMgr.List()
+		sort.Slice(repos, func(i, j int) bool { return repos[i].Name < repos[j].Name })
+		list := make([]dto.Repo, 0, len(repos))
+		for _, r := range repos {
+			list = append(list, dto.ToRepo(r))
+		}
+		t.result(list)
 		if len(repos) == 0 {
 			t.writeln(t.msg.NoRepositories)
 			return
@@ -193,11 +536,7 @@ func (t *TUI) handleRepo(args []string) {
 		for _, r := range repos {
 			users := make([]string, 0)
 			for u, p := range r.Users {
-				perm := "r"
-				if p == repo.PermWrite {
-					perm = "rw"
-				}
-				users = append(users, fmt.Sprintf("%s(%s)", u, perm))
+				users = append(users, fmt.Sprintf("%s(%s)", u, p.String()))
 			}
 			userStr := ""
 			if len(users) > 0 {
@@ -206,177 +545,1299 @@ func (t *TUI) handleRepo(args []string) {
 			t.writeln(fmt.Sprintf("  %s%s", r.Name, userStr))
 		}
 
-	case "create":
+	case "info":
 		if len(args) < 2 {
-			t.writeln(t.msg.RepoCreateUsage)
+			t.usage(t.msg.RepoInfoUsage)
+			return
+		}
+		t.showRepoInfo(args[1])
+
+	case "create":
+		template := ""
+		if len(args) == 4 && args[2] == "--template" {
+			template = args[3]
+		} else if len(args) != 2 {
+			t.usage(t.msg.RepoCreateUsage)
 			return
 		}
-		if err := t.repoMgr.Create(args[1]); err != nil {
-			t.writeln(t.msg.Error + err.Error())
+		skipped, err := t.svc.CreateRepo(args[1], template)
+		if err != nil {
+			t.failErr(err)
 			return
 		}
 		t.writeln(fmt.Sprintf(t.msg.RepoCreated, args[1]))
+		created := nameJSON{Name: args[1]}
+		for _, err := range skipped {
+			t.writeln(t.msg.TemplateGrantSkipped + err.Error())
+			created.Warnings = append(created.Warnings, err.Error())
+		}
+		t.result(created)
 		t.saveData()
 
+	case "templates":
+		templates, err := t.repoMgr.Templates()
+		if err != nil {
+			t.failErr(err)
+			return
+		}
+		list := make([]templateJSON, 0, len(templates))
+		for _, tmpl := range templates {
+			list = append(list, templateJSON{Name: tmpl.Name, Description: tmpl.Description})
+		}
+		t.result(list)
+		if len(templates) == 0 {
+			t.writeln(t.msg.NoTemplates)
+			return
+		}
+		for _, tmpl := range templates {
+			line := "  " + tmpl.Name
+			if tmpl.Description != "" {
+				line += " - " + tmpl.Description
+			}
+			t.writeln(line)
+		}
+
 	case "delete":
+		args, opts := cutConfirmFlags(args)
 		if len(args) < 2 {
-			t.writeln(t.msg.RepoDeleteUsage)
+			t.usage(t.msg.RepoDeleteUsage)
+			return
+		}
+		r := t.repoMgr.Get(args[1])
+		if r == nil {
+			t.fail(codeRepoNotFound, t.msg.RepoNotFound)
+			return
+		}
+		opts.typed = args[1]
+		if !t.confirm(opts, t.repoDeleteChanges(r)) {
 			return
 		}
 		if err := t.repoMgr.Delete(args[1]); err != nil {
-			t.writeln(t.msg.Error + err.Error())
+			t.failErr(err)
 			return
 		}
 		t.writeln(fmt.Sprintf(t.msg.RepoDeleted, args[1]))
+		t.result(nameJSON{Name: args[1]})
 		t.saveData()
 
-	case "adduser":
+	case "rename":
+		t.renameRepo(args[1:])
+
+	case "fork":
+		owner := ""
+		if len(args) == 5 && args[3] == "--owner" {
+			owner = args[4]
+		} else if len(args) != 3 {
+			t.usage(t.msg.RepoForkUsage)
+			return
+		}
+		if err := t.svc.ForkRepo(args[1], args[2], owner); err != nil {
+			t.failErr(err)
+			return
+		}
+		t.writeln(fmt.Sprintf(t.msg.RepoForked, args[1], args[2]))
+		t.resultRepo(args[2])
+		t.saveData()
+
+	case "set":
 		if len(args) < 4 {
-			t.writeln(t.msg.RepoAddUserUsage)
+			t.usage(t.msg.RepoSetUsage)
 			return
 		}
-		userName := args[2]
-		var perm repo.Permission
-		switch args[3] {
-		case "r":
-			perm = repo.PermRead
-		case "rw":
-			if userName == "guest" {
-				t.writeln(t.msg.GuestReadOnly)
-				return
+		var err error
+		switch args[2] {
+		case "description":
+			err = t.repoMgr.SetDescription(args[1], strings.Join(args[3:], " "))
+		case "branch":
+			err = t.repoMgr.SetDefaultBranch(args[1], args[3])
+		case "owner":
+			owner := args[3]
+			if owner == "-" {
+				owner = ""
 			}
-			perm = repo.PermWrite
+			err = t.svc.SetOwner(args[1], owner)
 		default:
-			t.writeln(t.msg.PermissionInvalid)
+			t.usage(t.msg.RepoSetUsage)
+			return
+		}
+		if err != nil {
+			t.failErr(err)
+			return
+		}
+		t.writeln(fmt.Sprintf(t.msg.RepoUpdated, args[1]))
+		t.resultRepo(args[1])
+		t.saveData()
+
+	case "archive", "unarchive":
+		if len(args) < 2 {
+			if args[0] == "archive" {
+				t.usage(t.msg.RepoArchiveUsage)
+			} else {
+				t.usage(t.msg.RepoUnarchiveUsage)
+			}
+			return
+		}
+		archived := args[0] == "archive"
+		if err := t.repoMgr.SetArchived(args[1], archived); err != nil {
+			t.failErr(err)
+			return
+		}
+		if archived {
+			t.writeln(fmt.Sprintf(t.msg.RepoArchived, args[1]))
+		} else {
+			t.writeln(fmt.Sprintf(t.msg.RepoUnarchived, args[1]))
+		}
+		t.resultRepo(args[1])
+		t.saveData()
+
+	case "adduser":
+		if len(args) < 4 {
+			t.usage(t.msg.RepoAddUserUsage)
+			return
+		}
+		userName := args[2]
+		perm, ok := repo.ParsePermission(args[3])
+		if !ok {
+			t.fail(codeInvalidArgument, t.msg.PermissionInvalid)
 			return
 		}
 		if userName != "guest" && t.authMgr.GetUser(userName) == nil {
-			t.writeln(t.msg.UserNotFound)
+			t.fail(codeUserNotFound, t.msg.UserNotFound)
 			return
 		}
-		if err := t.repoMgr.AddUser(args[1], userName, perm); err != nil {
-			t.writeln(t.msg.Error + err.Error())
+		if err := t.svc.GrantUser(args[1], userName, perm); err != nil {
+			t.failErr(err)
 			return
 		}
 		t.writeln(t.msg.UserAdded)
+		t.resultRepo(args[1])
 		t.saveData()
 
 	case "deluser":
+		args, opts := cutConfirmFlags(args)
 		if len(args) < 3 {
-			t.writeln(t.msg.RepoDelUserUsage)
+			t.usage(t.msg.RepoDelUserUsage)
+			return
+		}
+		r := t.repoMgr.Get(args[1])
+		if r == nil {
+			t.fail(codeRepoNotFound, t.msg.RepoNotFound)
+			return
+		}
+		changes := make([]changeJSON, 0, 1)
+		if perm, ok := r.Users[args[2]]; ok {
+			changes = revokeChanges([]service.Grant{{Repo: r.Name, User: args[2], Perm: perm}})
+		}
+		if !t.confirm(opts, changes) {
 			return
 		}
 		if err := t.repoMgr.RemoveUser(args[1], args[2]); err != nil {
-			t.writeln(t.msg.Error + err.Error())
+			t.failErr(err)
 			return
 		}
 		t.writeln(t.msg.UserRemoved)
+		t.resultRepo(args[1])
 		t.saveData()
 
-	default:
-		t.writeln(t.msg.UnknownRepoCommand)
-	}
-}
-
-// handleUser processes user management commands
-func (t *TUI) handleUser(args []string) {
-	if len(args) == 0 {
-		t.writeln(t.msg.UserUsage)
-		return
-	}
-
-	switch args[0] {
-	case "list":
-		users := t.authMgr.ListUsers()
-		if len(users) == 0 {
-			t.writeln(t.msg.NoUsers)
+	case "quota":
+		if len(args) < 3 {
+			t.usage(t.msg.RepoQuotaUsage)
 			return
 		}
-		for _, u := range users {
-			t.writeln(fmt.Sprintf("  %s (%d %s)", u.Name, len(u.Keys), t.msg.KeysCount))
+		size, err := repo.ParseSize(args[2])
+		if err != nil {
+			t.fail(codeInvalidArgument, t.msg.InvalidSize + args[2])
+			return
+		}
+		if err := t.repoMgr.SetQuota(args[1], size); err != nil {
+			t.failErr(err)
+			return
 		}
+		t.writeln(fmt.Sprintf(t.msg.QuotaSet, args[1], t.formatLimit(size)))
+		t.resultRepo(args[1])
+		t.saveData()
 
-	case "create":
-		if len(args) < 2 {
-			t.writeln(t.msg.UserCreateUsage)
+	case "maxblob":
+		if len(args) < 3 {
+			t.usage(t.msg.RepoMaxBlobUsage)
 			return
 		}
-		if args[1] == "guest" {
-			t.writeln(t.msg.CannotCreateGuest)
+		size, err := repo.ParseSize(args[2])
+		if err != nil {
+			t.fail(codeInvalidArgument, t.msg.InvalidSize + args[2])
 			return
 		}
-		if err := t.authMgr.CreateUser(args[1]); err != nil {
-			t.writeln(t.msg.Error + err.Error())
+		if err := t.repoMgr.SetMaxBlobSize(args[1], size); err != nil {
+			t.failErr(err)
 			return
 		}
-		t.writeln(fmt.Sprintf(t.msg.UserCreated, args[1]))
+		t.writeln(fmt.Sprintf(t.msg.MaxBlobSizeSet, args[1], t.formatLimit(size)))
+		t.resultRepo(args[1])
 		t.saveData()
 
-	case "delete":
+	case "lfs":
 		if len(args) < 2 {
-			t.writeln(t.msg.UserDeleteUsage)
+			t.usage(t.msg.RepoLfsUsage)
 			return
 		}
-		if args[1] == "guest" {
-			t.writeln(t.msg.CannotDeleteGuest)
+		t.showLFSObjects(args[1])
+
+	case "lfsgc":
+		if len(args) < 2 {
+			t.usage(t.msg.RepoLfsGCUsage)
 			return
 		}
-		if err := t.authMgr.DeleteUser(args[1]); err != nil {
-			t.writeln(t.msg.Error + err.Error())
+		t.collectLFSGarbage(args[1])
+
+	case "gc":
+		if len(args) < 2 {
+			t.usage(t.msg.RepoGCUsage)
 			return
 		}
-		t.writeln(fmt.Sprintf(t.msg.UserDeleted, args[1]))
-		t.saveData()
+		t.runMaintenance(args[1], repo.TaskGC)
+
+	case "fsck":
+		if len(args) < 2 {
+			t.usage(t.msg.RepoFsckUsage)
+			return
+		}
+		t.runMaintenance(args[1], repo.TaskFsck)
 
 	case "addkey":
-		if len(args) < 3 {
-			t.writeln(t.msg.UserAddKeyUsage)
+		if len(args) < 4 {
+			t.usage(t.msg.RepoAddKeyUsage)
+			return
+		}
+		perm, ok := repo.ParsePermission(args[2])
+		if !ok || perm > repo.PermWrite {
+			t.fail(codeInvalidArgument, t.msg.PermissionInvalid)
 			return
 		}
-		keyStr := strings.Join(args[2:], " ")
+		keyStr := strings.Join(args[3:], " ")
 		pubKey, _, _, _, err := gossh.ParseAuthorizedKey([]byte(keyStr))
 		if err != nil {
-			t.writeln(t.msg.InvalidPublicKey + err.Error())
+			t.fail(codeInvalidArgument, t.msg.InvalidPublicKey + err.Error())
 			return
 		}
-		if err := t.authMgr.AddKeyToUser(args[1], pubKey); err != nil {
-			t.writeln(t.msg.Error + err.Error())
+		if err := t.svc.AddDeployKey(args[1], pubKey, perm); err != nil {
+			t.failErr(err)
 			return
 		}
 		t.writeln(t.msg.KeyAdded)
+		t.result(dto.DeployKey{Fingerprint: gossh.FingerprintSHA256(pubKey), Perm: args[2]})
 		t.saveData()
 
 	case "delkey":
+		args, opts := cutConfirmFlags(args)
 		if len(args) < 3 {
-			t.writeln(t.msg.UserDelKeyUsage)
+			t.usage(t.msg.RepoDelKeyUsage)
 			return
 		}
-		if err := t.authMgr.RemoveKeyFromUser(args[1], args[2]); err != nil {
-			t.writeln(t.msg.Error + err.Error())
+		r := t.repoMgr.Get(args[1])
+		if r == nil {
+			t.fail(codeRepoNotFound, t.msg.RepoNotFound)
+			return
+		}
+		var changes []changeJSON
+		for _, dk := range r.DeployKeys {
+			if gossh.FingerprintSHA256(dk.Key) == args[2] {
+				changes = append(changes, deployKeyChange(r.Name, dk))
+			}
+		}
+		if len(changes) == 0 {
+			t.failErr(repo.ErrKeyNotFound)
+			return
+		}
+		if !t.confirm(opts, changes) {
+			return
+		}
+		if err := t.repoMgr.RemoveDeployKey(args[1], args[2]); err != nil {
+			t.failErr(err)
 			return
 		}
 		t.writeln(t.msg.KeyRemoved)
+		t.result(dto.DeployKey{Fingerprint: args[2]})
 		t.saveData()
 
 	case "keys":
 		if len(args) < 2 {
-			t.writeln(t.msg.UserKeysUsage)
+			t.usage(t.msg.RepoKeysUsage)
 			return
 		}
-		user := t.authMgr.GetUser(args[1])
-		if user == nil {
-			t.writeln(t.msg.UserNotFound)
+		r := t.repoMgr.Get(args[1])
+		if r == nil {
+			t.fail(codeRepoNotFound, t.msg.RepoNotFound)
 			return
 		}
-		if len(user.Keys) == 0 {
+		keys := dto.ToDeployKeys(r.DeployKeys)
+		t.result(keys)
+		if len(keys) == 0 {
 			t.writeln(t.msg.NoKeys)
 			return
 		}
-		for _, k := range user.Keys {
-			t.writeln("  " + gossh.FingerprintSHA256(k))
+		for _, k := range keys {
+			t.writeln(fmt.Sprintf("  %s (%s)", k.Fingerprint, k.Perm))
 		}
 
-	default:
-		t.writeln(t.msg.UnknownUserCommand)
+	case "scan":
+		names, err := t.repoMgr.Scan()
+		if err != nil {
+			t.failErr(err)
+			return
+		}
+		t.result(names)
+		if len(names) == 0 {
+			t.writeln(t.msg.NoUnregisteredRepos)
+			return
+		}
+		for _, name := range names {
+			t.writeln("  " + name)
+		}
+
+	case "import":
+		if len(args) < 2 {
+			t.usage(t.msg.RepoImportUsage)
+			return
+		}
+		names := args[1:2]
+		if args[1] == "--all" {
+			var err error
+			if names, err = t.repoMgr.Scan(); err != nil {
+				t.failErr(err)
+				return
+			}
+			if len(names) == 0 {
+				t.writeln(t.msg.NoUnregisteredRepos)
+				return
+			}
+		}
+		imported := make([]string, 0, len(names))
+		for _, name := range names {
+			if err := t.repoMgr.Import(name); err != nil {
+				t.failErr(err)
+				continue
+			}
+			t.writeln(fmt.Sprintf(t.msg.RepoImported, name))
+			imported = append(imported, name)
+		}
+		t.result(imported)
+		t.saveData()
+
+	case "trash":
+		if len(args) > 1 && args[1] != "list" {
+			t.fail(codeUnknownCommand, t.msg.UnknownRepoCommand)
+			return
+		}
+		t.showTrash()
+
+	case "restore":
+		if len(args) < 2 {
+			t.usage(t.msg.RepoRestoreUsage)
+			return
+		}
+		revoked, err := t.svc.RestoreRepo(args[1])
+		if err != nil {
+			t.failErr(err)
+			return
+		}
+		t.writeln(fmt.Sprintf(t.msg.RepoRestored, args[1]))
+		t.result(nameJSON{Name: args[1], Revoked: dto.ToGrants(revoked)})
+		if len(revoked) > 0 {
+			t.writeln(t.msg.GrantsRevoked.Format(len(revoked)))
+			t.writeGrants(revoked)
+		}
+		t.saveData()
+
+	case "purge":
+		args, opts := cutConfirmFlags(args)
+		if !t.confirm(opts, t.purgeChanges(args)) {
+			return
+		}
+		var purged []*repo.TrashEntry
+		var err error
+		switch {
+		case len(args) < 2:
+			purged, err = t.repoMgr.PurgeExpired(time.Now())
+		case args[1] == "--all":
+			purged, err = t.repoMgr.Purge("")
+		default:
+			purged, err = t.repoMgr.Purge(args[1])
+		}
+		if err != nil {
+			t.failErr(err)
+		}
+		list := make([]trashJSON, 0, len(purged))
+		for _, e := range purged {
+			list = append(list, toTrashJSON(e))
+		}
+		t.result(list)
+		t.writeln(t.msg.TrashPurged.Format(len(purged)))
+
+	default:
+		t.fail(codeUnknownCommand, t.msg.UnknownRepoCommand)
+	}
+}
+
+// handleUser processes user management commands
+func (t *TUI) handleUser(args []string) {
+	if len(args) == 0 {
+		t.usage(t.msg.UserUsage)
+		return
+	}
+
+	switch args[0] {
+	case "list":
+		users := t.authMgr.ListUsers()
+		sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+		list := make([]dto.User, 0, len(users))
+		for _, u := range users {
+			list = append(list, dto.ToUser(u))
+		}
+		t.result(list)
+		if len(users) == 0 {
+			t.writeln(t.msg.NoUsers)
+			return
+		}
+		for _, u := range users {
+			line := fmt.Sprintf("  %s (%s)", u.Name, t.msg.KeyCount.Format(len(u.Keys)))
+			if len(u.Roles) > 0 {
+				line += " [" + strings.Join(u.Roles, ", ") + "]"
+			}
+			t.writeln(line)
+		}
+
+	case "create":
+		if len(args) < 2 {
+			t.usage(t.msg.UserCreateUsage)
+			return
+		}
+		if args[1] == "guest" {
+			t.fail(codeGuestReserved, t.msg.CannotCreateGuest)
+			return
+		}
+		if err := t.svc.CreateUser(args[1]); err != nil {
+			t.failErr(err)
+			return
+		}
+		t.writeln(fmt.Sprintf(t.msg.UserCreated, args[1]))
+		t.result(nameJSON{Name: args[1]})
+		t.saveData()
+
+	case "delete":
+		args, opts := cutConfirmFlags(args)
+		if len(args) < 2 {
+			t.usage(t.msg.UserDeleteUsage)
+			return
+		}
+		if args[1] == "guest" {
+			t.fail(codeGuestReserved, t.msg.CannotDeleteGuest)
+			return
+		}
+		user := t.authMgr.GetUser(args[1])
+		if user == nil {
+			t.fail(codeUserNotFound, t.msg.UserNotFound)
+			return
+		}
+		cascade := len(args) > 2 && args[2] == "--cascade"
+		plan, err := t.svc.PlanDeleteUser(args[1], cascade)
+		if err == service.ErrUserHasGrants {
+			t.fail(codeUserHasGrants, t.msg.UserHasGrants)
+			t.result(dto.ToGrants(plan.Grants))
+			t.writeGrants(plan.Grants)
+			return
+		}
+		if err != nil {
+			t.failErr(err)
+			return
+		}
+		if !t.confirm(opts, t.userDeleteChanges(user, plan)) {
+			return
+		}
+		grants, err := t.svc.DeleteUser(args[1], cascade)
+		if err != nil {
+			// The user is deleted before the grants are revoked, keep what was done
+			if t.authMgr.GetUser(args[1]) == nil {
+				if len(grants) > 0 {
+					t.writeln(t.msg.GrantsRevoked.Format(len(grants)))
+				}
+				t.saveData()
+			}
+			t.failErr(err)
+			return
+		}
+		if len(grants) > 0 {
+			t.writeln(t.msg.GrantsRevoked.Format(len(grants)))
+		}
+		t.writeln(fmt.Sprintf(t.msg.UserDeleted, args[1]))
+		t.result(nameJSON{Name: args[1], Revoked: dto.ToGrants(grants)})
+		t.saveData()
+
+	case "addkey":
+		if len(args) < 3 {
+			t.usage(t.msg.UserAddKeyUsage)
+			return
+		}
+		keyArgs := args[2:]
+		var expiresAt time.Time
+		if keyArgs[0] == "--expires" {
+			if len(keyArgs) < 3 {
+				t.usage(t.msg.UserAddKeyUsage)
+				return
+			}
+			exp, err := parseExpiry(keyArgs[1])
+			if err != nil {
+				t.fail(codeInvalidArgument, t.msg.InvalidDate + keyArgs[1])
+				return
+			}
+			expiresAt = exp
+			keyArgs = keyArgs[2:]
+		}
+		keyStr := strings.Join(keyArgs, " ")
+		pubKey, comment, _, _, err := gossh.ParseAuthorizedKey([]byte(keyStr))
+		if err != nil {
+			t.fail(codeInvalidArgument, t.msg.InvalidPublicKey + err.Error())
+			return
+		}
+		key := &auth.Key{
+			PublicKey: pubKey,
+			Comment:   comment,
+			AddedAt:   time.Now(),
+			AddedBy:   t.actor,
+			ExpiresAt: expiresAt,
+		}
+		if err := t.svc.AddUserKey(args[1], key); err != nil {
+			t.failErr(err)
+			return
+		}
+		t.writeln(t.msg.KeyAdded)
+		t.result(dto.ToKey(key))
+		t.saveData()
+
+	case "delkey":
+		args, opts := cutConfirmFlags(args)
+		if len(args) < 3 {
+			t.usage(t.msg.UserDelKeyUsage)
+			return
+		}
+		user := t.authMgr.GetUser(args[1])
+		if user == nil {
+			t.fail(codeUserNotFound, t.msg.UserNotFound)
+			return
+		}
+		key := user.FindKey(args[2])
+		if key == nil {
+			t.failErr(auth.ErrKeyNotFound)
+			return
+		}
+		if !t.confirm(opts, []changeJSON{keyChange(args[1], key)}) {
+			return
+		}
+		if err := t.authMgr.RemoveKeyFromUser(args[1], args[2]); err != nil {
+			t.failErr(err)
+			return
+		}
+		t.writeln(t.msg.KeyRemoved)
+		t.result(dto.Key{Fingerprint: args[2]})
+		t.saveData()
+
+	case "keys":
+		if len(args) < 2 {
+			t.usage(t.msg.UserKeysUsage)
+			return
+		}
+		user := t.authMgr.GetUser(args[1])
+		if user == nil {
+			t.fail(codeUserNotFound, t.msg.UserNotFound)
+			return
+		}
+		t.result(dto.ToKeys(user.Keys))
+		if len(user.Keys) == 0 {
+			t.writeln(t.msg.NoKeys)
+			return
+		}
+		for _, k := range user.Keys {
+			t.writeln(fmt.Sprintf("  %s  %s", k.Fingerprint(), k.Comment))
+			t.writeln("    " + t.describeKey(k))
+		}
+
+	case "expirekey":
+		if len(args) < 4 {
+			t.usage(t.msg.UserExpireKeyUsage)
+			return
+		}
+		var expiresAt time.Time
+		if args[3] != "never" {
+			exp, err := parseExpiry(args[3])
+			if err != nil {
+				t.fail(codeInvalidArgument, t.msg.InvalidDate + args[3])
+				return
+			}
+			expiresAt = exp
+		}
+		if err := t.authMgr.SetKeyExpiry(args[1], args[2], expiresAt); err != nil {
+			t.failErr(err)
+			return
+		}
+		t.writeln(t.msg.KeyExpirySet)
+		if user := t.authMgr.GetUser(args[1]); user != nil {
+			if k := user.FindKey(args[2]); k != nil {
+				t.result(dto.ToKey(k))
+			}
+		}
+		t.saveData()
+
+	case "stalekeys":
+		if len(args) < 2 {
+			t.usage(t.msg.UserStaleKeysUsage)
+			return
+		}
+		days, err := strconv.Atoi(args[1])
+		if err != nil || days < 0 {
+			t.fail(codeInvalidArgument, t.msg.InvalidDays + args[1])
+			return
+		}
+		t.showStaleKeys(time.Now().AddDate(0, 0, -days))
+
+	case "quota":
+		if len(args) < 3 {
+			t.usage(t.msg.UserQuotaUsage)
+			return
+		}
+		size, err := repo.ParseSize(args[2])
+		if err != nil {
+			t.fail(codeInvalidArgument, t.msg.InvalidSize + args[2])
+			return
+		}
+		if err := t.authMgr.SetUserQuota(args[1], size); err != nil {
+			t.failErr(err)
+			return
+		}
+		t.writeln(fmt.Sprintf(t.msg.QuotaSet, args[1], t.formatLimit(size)))
+		if user := t.authMgr.GetUser(args[1]); user != nil {
+			t.result(dto.ToUser(user))
+		}
+		t.saveData()
+
+	case "role":
+		if len(args) != 3 {
+			t.usage(t.msg.UserRoleUsage)
+			return
+		}
+		var roles []string
+		switch args[2] {
+		case auth.RoleAdmin:
+			roles = []string{auth.RoleAdmin}
+		case "none":
+		default:
+			t.fail(codeInvalidArgument, t.msg.RoleInvalid)
+			return
+		}
+		if err := t.authMgr.SetUserRoles(args[1], roles); err != nil {
+			t.failErr(err)
+			return
+		}
+		if roles == nil {
+			t.writeln(fmt.Sprintf(t.msg.RolesCleared, args[1]))
+		} else {
+			t.writeln(fmt.Sprintf(t.msg.RoleSet, args[1], args[2]))
+		}
+		if user := t.authMgr.GetUser(args[1]); user != nil {
+			t.result(dto.ToUser(user))
+		}
+		t.saveData()
+
+	default:
+		t.fail(codeUnknownCommand, t.msg.UnknownUserCommand)
+	}
+}
+
+// showRepoInfo displays the details and disk usage of a repository
+func (t *TUI) showRepoInfo(name string) {
+	r := t.repoMgr.Get(name)
+	if r == nil {
+		t.fail(codeRepoNotFound, t.msg.RepoNotFound)
+		return
+	}
+	size, err := t.repoMgr.Size(r.Name)
+	if err != nil {
+		t.failErr(err)
+		return
+	}
+
+	users := make([]string, 0, len(r.Users))
+	for u, p := range r.Users {
+		users = append(users, fmt.Sprintf("%s(%s)", u, p.String()))
+	}
+
+	branch, err := t.repoMgr.DefaultBranch(r.Name)
+	if err != nil {
+		branch = ""
+	}
+	status := t.msg.StatusActive
+	if r.Archived {
+		status = t.msg.StatusArchived
+	}
+	lastPush := t.msg.Never
+	if !r.LastPush.IsZero() {
+		lastPush = r.LastPush.Format(timeFormat)
+	}
+
+	aliases := make(map[string]time.Time, len(r.Aliases))
+	for name, expires := range r.Aliases {
+		aliases[name] = expires
+	}
+	t.result(repoInfoJSON{
+		Repo:          dto.ToRepo(r),
+		Path:          r.Path,
+		Size:          size,
+		DefaultBranch: branch,
+		Aliases:       aliases,
+	})
+
+	t.writeln(t.msg.InfoName + r.Name)
+	t.writeln(t.msg.InfoDescription + orDefault(r.Description, t.msg.NotSet))
+	t.writeln(t.msg.InfoOwner + orDefault(r.Owner, t.msg.NotSet))
+	if r.ForkOf != "" {
+		t.writeln(t.msg.InfoForkOf + r.ForkOf)
+	}
+	t.writeln(t.msg.InfoBranch + orDefault(branch, t.msg.NotSet))
+	t.writeln(t.msg.InfoStatus + status)
+	t.writeln(t.msg.InfoLastPush + lastPush)
+	if run := r.Maintenance[repo.TaskGC]; run != nil {
+		t.writeln(t.msg.InfoGC + t.describeRun(run))
+	}
+	if run := r.Maintenance[repo.TaskFsck]; run != nil {
+		t.writeln(t.msg.InfoFsck + t.describeRun(run))
+	}
+	t.writeln(t.msg.InfoPath + r.Path)
+	t.writeln(t.msg.InfoSize + repo.FormatSize(size) + " / " + t.formatLimit(r.Quota))
+	t.writeln(t.msg.InfoMaxBlobSize + t.formatLimit(r.MaxBlobSize))
+	t.writeln(t.msg.InfoUsers + strings.Join(users, ", "))
+	if len(r.Aliases) > 0 {
+		aliases := make([]string, 0, len(r.Aliases))
+		for name, expires := range r.Aliases {
+			aliases = append(aliases, fmt.Sprintf("%s (%s)", name, expires.Format(dateFormat)))
+		}
+		sort.Strings(aliases)
+		t.writeln(t.msg.InfoAliases + strings.Join(aliases, ", "))
+	}
+}
+
+// defaultAliasDays is how long the old name of a renamed repository keeps working
+const defaultAliasDays = 30
+
+// renameRepo handles "repo rename <old> <new> [--alias <days>]"
+func (t *TUI) renameRepo(args []string) {
+	days := defaultAliasDays
+	if len(args) == 4 && args[2] == "--alias" {
+		n, err := strconv.Atoi(args[3])
+		if err != nil || n < 0 {
+			t.fail(codeInvalidArgument, t.msg.InvalidDays + args[3])
+			return
+		}
+		days = n
+		args = args[:2]
+	}
+	if len(args) != 2 {
+		t.usage(t.msg.RepoRenameUsage)
+		return
+	}
+
+	aliasFor := time.Duration(days) * 24 * time.Hour
+	if err := t.repoMgr.Rename(args[0], args[1], aliasFor); err != nil {
+		t.failErr(err)
+		return
+	}
+	t.writeln(fmt.Sprintf(t.msg.RepoRenamed, args[0], args[1]))
+	t.result(nameJSON{Name: args[1], From: args[0]})
+	if days > 0 {
+		t.writeln(fmt.Sprintf(t.msg.RepoAliasKept, args[0], time.Now().Add(aliasFor).Format(dateFormat)))
+	}
+	t.saveData()
+}
+
+// runMaintenance runs a maintenance task and streams git's output into the session
+func (t *TUI) runMaintenance(name, task string) {
+	before, err := t.repoMgr.ObjectStats(name)
+	if err != nil {
+		t.failErr(err)
+		return
+	}
+	t.writeln(fmt.Sprintf(t.msg.ObjectStats, before.Loose, before.Packs))
+
+	run, err := t.repoMgr.Maintain(name, task, t.output())
+	if err != nil {
+		t.failErr(err)
+		return
+	}
+	if run.OK {
+		t.writeln(fmt.Sprintf(t.msg.MaintenanceDone, task, run.Duration.Round(time.Millisecond)))
+	} else {
+		t.fail(codeMaintenanceFailed, fmt.Sprintf(t.msg.MaintenanceFailed, task, run.Message))
+	}
+	result := maintenanceJSON{
+		Name:       name,
+		Task:       task,
+		OK:         run.OK,
+		DurationMs: run.Duration.Milliseconds(),
+		Message:    run.Message,
+		Before:     objectStatsJSON{Loose: before.Loose, Packs: before.Packs},
+	}
+	if after, err := t.repoMgr.ObjectStats(name); err == nil {
+		t.writeln(fmt.Sprintf(t.msg.ObjectStats, after.Loose, after.Packs))
+		result.After = objectStatsJSON{Loose: after.Loose, Packs: after.Packs}
+	}
+	t.result(result)
+	t.saveData()
+}
+
+// describeRun renders the recorded result of a maintenance task
+func (t *TUI) describeRun(run *repo.MaintenanceRun) string {
+	started := run.StartedAt.Format(timeFormat)
+	if run.OK {
+		return fmt.Sprintf(t.msg.RunOK, started, run.Duration.Round(time.Second))
+	}
+	return fmt.Sprintf(t.msg.RunFailed, started, run.Message)
+}
+
+// crlfWriter translates line feeds into the CRLF line endings a terminal session expects
+type crlfWriter struct {
+	w io.Writer
+}
+
+// Write implements io.Writer
+func (c crlfWriter) Write(p []byte) (int, error) {
+	if _, err := c.w.Write(bytes.ReplaceAll(p, []byte("\n"), []byte("\r\n"))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// orDefault returns s, or fallback when s is empty
+func orDefault(s, fallback string) string {
+	if s == "" {
+		return fallback
+	}
+	return s
+}
+
+// formatLimit renders a size limit, where 0 means unlimited
+func (t *TUI) formatLimit(n int64) string {
+	if n <= 0 {
+		return t.msg.Unlimited
+	}
+	return repo.FormatSize(n)
+}
+
+// showLFSObjects lists the LFS objects of a repository and marks orphans
+func (t *TUI) showLFSObjects(name string) {
+	r := t.repoMgr.Get(name)
+	if r == nil {
+		t.fail(codeRepoNotFound, t.msg.RepoNotFound)
+		return
+	}
+	objects, err := lfs.NewStore(r.Path).List()
+	if err != nil {
+		t.failErr(err)
+		return
+	}
+	orphans, err := lfs.Orphans(r.Path, time.Now())
+	if err != nil {
+		t.failErr(err)
+		return
+	}
+
+	orphaned := make(map[string]bool, len(orphans))
+	var total, orphanSize int64
+	for _, o := range orphans {
+		orphaned[o.OID] = true
+		orphanSize += o.Size
+	}
+	list := make([]lfsObjectJSON, 0, len(objects))
+	for _, o := range objects {
+		list = append(list, lfsObjectJSON{OID: o.OID, Size: o.Size, Orphaned: orphaned[o.OID]})
+	}
+	t.result(list)
+	for _, o := range objects {
+		total += o.Size
+		line := fmt.Sprintf("  %s %s", o.OID, repo.FormatSize(o.Size))
+		if orphaned[o.OID] {
+			line += " (" + t.msg.LfsOrphaned + ")"
+		}
+		t.writeln(line)
+	}
+	t.writeln(fmt.Sprintf(t.msg.LfsSummary, len(objects), repo.FormatSize(total),
+		len(orphans), repo.FormatSize(orphanSize)))
+}
+
+// collectLFSGarbage removes the orphaned LFS objects of a repository
+func (t *TUI) collectLFSGarbage(name string) {
+	r := t.repoMgr.Get(name)
+	if r == nil {
+		t.fail(codeRepoNotFound, t.msg.RepoNotFound)
+		return
+	}
+	orphans, err := lfs.Orphans(r.Path, time.Now())
+	if err != nil {
+		t.failErr(err)
+		return
+	}
+
+	store := lfs.NewStore(r.Path)
+	removed, freed := 0, int64(0)
+	for _, o := range orphans {
+		if err := store.Remove(o.OID); err != nil {
+			t.failErr(err)
+			continue
+		}
+		removed++
+		freed += o.Size
+	}
+	t.writeln(t.msg.LfsGCDone.Format(removed, repo.FormatSize(freed)))
+	t.result(lfsGCJSON{Removed: removed, Freed: freed})
+}
+
+// describeKey summarizes the metadata of a user key in one line
+func (t *TUI) describeKey(k *auth.Key) string {
+	parts := make([]string, 0, 3)
+	if k.AddedAt.IsZero() {
+		parts = append(parts, t.msg.KeyAddedUnknown)
+	} else {
+		parts = append(parts, fmt.Sprintf(t.msg.KeyAddedBy, k.AddedAt.Format(dateFormat), k.AddedBy))
+	}
+	if k.LastUsed.IsZero() {
+		parts = append(parts, t.msg.KeyNeverUsed)
+	} else {
+		parts = append(parts, fmt.Sprintf(t.msg.KeyLastUsed, k.LastUsed.Format(timeFormat), k.LastIP))
+	}
+	if k.Expired(time.Now()) {
+		parts = append(parts, fmt.Sprintf(t.msg.KeyExpired, k.ExpiresAt.Format(dateFormat)))
+	} else if !k.ExpiresAt.IsZero() {
+		parts = append(parts, fmt.Sprintf(t.msg.KeyExpires, k.ExpiresAt.Format(dateFormat)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// showStaleKeys lists user keys that have not been used since the cutoff.
+// Keys that were never used count from the time they were added.
+func (t *TUI) showStaleKeys(cutoff time.Time) {
+	found := false
+	stale := make([]staleKeyJSON, 0)
+	for _, u := range t.authMgr.ListUsers() {
+		for _, k := range u.Keys {
+			lastSeen := k.LastUsed
+			if lastSeen.IsZero() {
+				lastSeen = k.AddedAt
+			}
+			if lastSeen.After(cutoff) {
+				continue
+			}
+			found = true
+			stale = append(stale, staleKeyJSON{User: u.Name, Key: dto.ToKey(k)})
+			t.writeln(fmt.Sprintf("  %s  %s  %s", u.Name, k.Fingerprint(), k.Comment))
+			t.writeln("    " + t.describeKey(k))
+		}
+	}
+	t.result(stale)
+	if !found {
+		t.writeln(t.msg.NoStaleKeys)
+	}
+}
+
+// showTrash lists the deleted repositories kept in the trash
+func (t *TUI) showTrash() {
+	entries := t.repoMgr.ListTrash()
+	list := make([]trashJSON, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, toTrashJSON(e))
+	}
+	t.result(list)
+	if len(entries) == 0 {
+		t.writeln(t.msg.TrashEmpty)
+		return
+	}
+	for _, e := range entries {
+		deleted := e.DeletedAt.Format(timeFormat)
+		if e.ExpiresAt.IsZero() {
+			t.writeln(fmt.Sprintf(t.msg.TrashKeptForever, e.Repo.Name, deleted))
+		} else {
+			t.writeln(fmt.Sprintf(t.msg.TrashEntry, e.Repo.Name, deleted, e.ExpiresAt.Format(timeFormat)))
+		}
+	}
+}
+
+// handleFsck reports grants that refer to deleted users and removes them with --fix
+func (t *TUI) handleFsck(args []string) {
+	args, opts := cutConfirmFlags(args)
+	grants := t.svc.DanglingGrants()
+	t.result(fsckJSON{Dangling: dto.ToGrants(grants)})
+	if len(grants) == 0 {
+		t.writeln(t.msg.FsckClean)
+		return
+	}
+	t.writeGrants(grants)
+
+	if len(args) == 0 || args[0] != "--fix" {
+		t.writeln(t.msg.FsckFound.Format(len(grants)))
+		return
+	}
+	if !t.confirm(opts, revokeChanges(grants)) {
+		return
+	}
+	fixed, err := t.svc.FixDanglingGrants()
+	if err != nil {
+		t.failErr(err)
+		return
+	}
+	t.writeln(t.msg.FsckFixed.Format(len(fixed)))
+	t.result(fsckJSON{Dangling: dto.ToGrants(grants), Fixed: len(fixed)})
+	t.saveData()
+}
+
+// handleBackup writes a backup of all data, by default below data/backups
+func (t *TUI) handleBackup(args []string) {
+	if len(args) > 1 {
+		t.usage(t.msg.BackupUsage)
+		return
+	}
+	path := backup.DefaultPath(t.dataPath, time.Now())
+	if len(args) == 1 {
+		path = args[0]
+	}
+
+	t.writeln(t.msg.BackupStarted)
+	manifest, err := backup.CreateFile(path, t.dataPath, t.authMgr, t.repoMgr)
+	if err != nil {
+		t.failErr(err)
+		return
+	}
+	size := "?"
+	if info, err := os.Stat(path); err == nil {
+		size = repo.FormatSize(info.Size())
+	}
+	t.writeln(fmt.Sprintf(t.msg.BackupDone, manifest.Users, len(manifest.Repos), path, size))
+	t.result(backupJSON{Path: path, Manifest: manifest})
+}
+
+// handleToken manages the bearer tokens of the HTTP admin API
+func (t *TUI) handleToken(args []string) {
+	if len(args) == 0 {
+		t.usage(t.msg.TokenUsage)
+		return
+	}
+
+	switch args[0] {
+	case "list":
+		tokens := t.tokens.List()
+		list := make([]tokenJSON, 0, len(tokens))
+		for _, tok := range tokens {
+			list = append(list, toTokenJSON(tok))
+		}
+		t.result(list)
+		if len(tokens) == 0 {
+			t.writeln(t.msg.NoTokens)
+			return
+		}
+		for _, tok := range tokens {
+			t.writeln(fmt.Sprintf("  %s  %s", tok.ID, tok.Name))
+			t.writeln("    " + t.describeToken(tok))
+		}
+
+	case "create":
+		var expiresAt time.Time
+		if len(args) == 4 && args[2] == "--expires" {
+			exp, err := parseExpiry(args[3])
+			if err != nil {
+				t.fail(codeInvalidArgument, t.msg.InvalidDate + args[3])
+				return
+			}
+			expiresAt = exp
+		} else if len(args) != 2 {
+			t.usage(t.msg.TokenCreateUsage)
+			return
+		}
+		tok, secret, err := t.tokens.Issue(args[1], t.actor, expiresAt)
+		if err != nil {
+			t.failErr(err)
+			return
+		}
+		t.writeln(fmt.Sprintf(t.msg.TokenCreated, tok.ID))
+		t.writeln("  " + secret)
+		created := toTokenJSON(tok)
+		created.Token = secret
+		t.result(created)
+		t.saveTokens()
+
+	case "revoke":
+		args, opts := cutConfirmFlags(args)
+		if len(args) != 2 {
+			t.usage(t.msg.TokenRevokeUsage)
+			return
+		}
+		var changes []changeJSON
+		for _, tok := range t.tokens.List() {
+			if tok.ID == args[1] {
+				changes = append(changes, changeJSON{Action: actionRevokeToken, Token: tok.ID, Comment: tok.Name})
+			}
+		}
+		if len(changes) == 0 {
+			t.failErr(auth.ErrTokenNotFound)
+			return
+		}
+		if !t.confirm(opts, changes) {
+			return
+		}
+		if err := t.tokens.Revoke(args[1]); err != nil {
+			t.failErr(err)
+			return
+		}
+		t.writeln(fmt.Sprintf(t.msg.TokenRevoked, args[1]))
+		t.result(tokenJSON{ID: args[1]})
+		t.saveTokens()
+
+	default:
+		t.fail(codeUnknownCommand, t.msg.UnknownCommand + args[0])
+	}
+}
+
+// handleAdmin manages the administrators and their keys
+func (t *TUI) handleAdmin(args []string) {
+	if len(args) == 0 {
+		t.usage(t.msg.AdminUsage)
+		return
+	}
+
+	switch args[0] {
+	case "list":
+		admins := t.authMgr.ListAdmins()
+		sort.Slice(admins, func(i, j int) bool { return admins[i].Name < admins[j].Name })
+		list := make([]adminJSON, 0, len(admins))
+		for _, a := range admins {
+			list = append(list, adminJSON{Name: a.Name, Keys: dto.ToKeys(a.Keys), Self: a.Name == t.actor})
+		}
+		t.result(list)
+		for _, a := range admins {
+			line := fmt.Sprintf("  %s (%s)", a.Name, t.msg.KeyCount.Format(len(a.Keys)))
+			if a.Name == t.actor {
+				line += " " + t.msg.AdminYou
+			}
+			t.writeln(line)
+			for _, k := range a.Keys {
+				t.writeln(fmt.Sprintf("    %s  %s", k.Fingerprint(), k.Comment))
+			}
+		}
+
+	case "add":
+		if len(args) < 3 {
+			t.usage(t.msg.AdminAddUsage)
+			return
+		}
+		pubKey, comment, _, _, err := gossh.ParseAuthorizedKey([]byte(strings.Join(args[2:], " ")))
+		if err != nil {
+			t.fail(codeInvalidArgument, t.msg.InvalidPublicKey + err.Error())
+			return
+		}
+		key := &auth.Key{
+			PublicKey: pubKey,
+			Comment:   comment,
+			AddedAt:   time.Now(),
+			AddedBy:   t.actor,
+		}
+		if err := t.svc.AddAdminKey(args[1], key); err != nil {
+			t.failErr(err)
+			return
+		}
+		t.writeln(fmt.Sprintf(t.msg.AdminKeyAdded, args[1]))
+		t.result(dto.ToKey(key))
+		t.saveAdmins()
+
+	case "delkey":
+		args, opts := cutConfirmFlags(args)
+		if len(args) != 3 {
+			t.usage(t.msg.AdminDelKeyUsage)
+			return
+		}
+		admin := t.authMgr.GetAdmin(args[1])
+		if admin == nil {
+			t.failErr(&auth.AdminNotFoundError{Name: args[1]})
+			return
+		}
+		key := admin.FindKey(args[2])
+		if key == nil {
+			t.failErr(auth.ErrKeyNotFound)
+			return
+		}
+		if !t.confirm(opts, []changeJSON{adminKeyChange(admin.Name, key)}) {
+			return
+		}
+		if err := t.authMgr.RemoveAdminKey(args[1], args[2]); err != nil {
+			t.failErr(err)
+			return
+		}
+		t.writeln(t.msg.KeyRemoved)
+		t.result(dto.Key{Fingerprint: args[2]})
+		t.saveAdmins()
+
+	case "remove":
+		args, opts := cutConfirmFlags(args)
+		if len(args) != 2 {
+			t.usage(t.msg.AdminRemoveUsage)
+			return
+		}
+		admin := t.authMgr.GetAdmin(args[1])
+		if admin == nil {
+			t.failErr(&auth.AdminNotFoundError{Name: args[1]})
+			return
+		}
+		if !t.confirm(opts, adminRemoveChanges(admin)) {
+			return
+		}
+		if err := t.authMgr.RemoveAdmin(args[1]); err != nil {
+			t.failErr(err)
+			return
+		}
+		t.writeln(fmt.Sprintf(t.msg.AdminRemoved, args[1]))
+		t.result(nameJSON{Name: args[1]})
+		t.saveAdmins()
+
+	default:
+		t.fail(codeUnknownCommand, t.msg.UnknownCommand + args[0])
+	}
+}
+
+// saveAdmins persists the administrators to disk
+func (t *TUI) saveAdmins() {
+	if err := t.authMgr.SaveAdminsToFile(t.dataPath + "/admins.json"); err != nil {
+		t.fail(codeSaveFailed, t.msg.SaveAdminDataFailed + err.Error())
+	}
+}
+
+// describeToken summarizes who issued a token, its use and its expiry
+func (t *TUI) describeToken(tok *auth.Token) string {
+	parts := []string{fmt.Sprintf(t.msg.KeyAddedBy, tok.CreatedAt.Format(dateFormat), tok.CreatedBy)}
+	if tok.LastUsed.IsZero() {
+		parts = append(parts, t.msg.KeyNeverUsed)
+	} else {
+		parts = append(parts, fmt.Sprintf(t.msg.TokenLastUsed, tok.LastUsed.Format(timeFormat)))
+	}
+	if tok.Expired(time.Now()) {
+		parts = append(parts, fmt.Sprintf(t.msg.KeyExpired, tok.ExpiresAt.Format(dateFormat)))
+	} else if !tok.ExpiresAt.IsZero() {
+		parts = append(parts, fmt.Sprintf(t.msg.KeyExpires, tok.ExpiresAt.Format(dateFormat)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// saveTokens persists the HTTP API tokens to disk
+func (t *TUI) saveTokens() {
+	if err := t.tokens.SaveToFile(t.dataPath + "/tokens.json"); err != nil {
+		t.fail(codeSaveFailed, t.msg.SaveTokenDataFailed + err.Error())
+	}
+}
+
+// writeGrants lists repository grants, one per line
+func (t *TUI) writeGrants(grants []service.Grant) {
+	for _, g := range grants {
+		t.writeln(fmt.Sprintf("  %s: %s(%s)", g.Repo, g.User, g.Perm.String()))
 	}
 }
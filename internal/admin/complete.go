@@ -0,0 +1,267 @@
+package admin
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/touken928/gitlite/internal/i18n"
+	"github.com/touken928/gitlite/internal/service"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// topCommands lists the commands completed at the start of a line
+var topCommands = []string{"admin", "backup", "exit", "fsck", "help", "lang", "output", "quit", "repo", "token", "user"}
+
+// repoCommands lists the subcommands of "repo"
+var repoCommands = []string{
+	"addkey", "adduser", "archive", "create", "delete", "delkey", "deluser", "fork",
+	"fsck", "gc", "import", "info", "keys", "lfs", "lfsgc", "list", "maxblob", "purge",
+	"quota", "rename", "restore", "scan", "set", "templates", "trash", "unarchive",
+}
+
+// userCommands lists the subcommands of "user"
+var userCommands = []string{
+	"addkey", "create", "delete", "delkey", "expirekey", "keys", "list", "quota", "role", "stalekeys",
+}
+
+// repoNameCommands lists the repo subcommands whose first argument is a repository
+var repoNameCommands = map[string]bool{
+	"addkey": true, "adduser": true, "archive": true, "delete": true, "delkey": true,
+	"deluser": true, "fork": true, "fsck": true, "gc": true, "info": true, "keys": true,
+	"lfs": true, "lfsgc": true, "maxblob": true, "quota": true, "rename": true,
+	"set": true, "unarchive": true,
+}
+
+// userNameCommands lists the user subcommands whose first argument is a user
+var userNameCommands = map[string]bool{
+	"addkey": true, "delete": true, "delkey": true, "expirekey": true, "keys": true, "quota": true, "role": true,
+}
+
+// completeArgs returns the completions of word, given the words before it
+func (t *TUI) completeArgs(words []string, word string) []string {
+	return matchPrefix(t.candidates(words), word)
+}
+
+// candidates returns everything that may follow words on a command line
+func (t *TUI) candidates(words []string) []string {
+	if len(words) == 0 {
+		return topCommands
+	}
+	switch words[0] {
+	case "lang":
+		if len(words) == 1 {
+			return append(i18n.Languages(), "auto")
+		}
+	case "output":
+		if len(words) == 1 {
+			return []string{"json", "text"}
+		}
+	case "fsck":
+		if len(words) == 1 {
+			return []string{"--fix"}
+		}
+		if len(words) == 2 && words[1] == "--fix" {
+			return confirmFlags
+		}
+	case "repo":
+		return t.repoCandidates(words[1:])
+	case "user":
+		return t.userCandidates(words[1:])
+	case "token":
+		return t.tokenCandidates(words[1:])
+	case "admin":
+		return t.adminCandidates(words[1:])
+	}
+	return nil
+}
+
+// repoCandidates completes the arguments of "repo"
+func (t *TUI) repoCandidates(args []string) []string {
+	if len(args) == 0 {
+		return repoCommands
+	}
+	sub := args[0]
+	switch len(args) {
+	case 1:
+		switch {
+		case repoNameCommands[sub]:
+			return t.repoNames()
+		case sub == "restore" || sub == "purge":
+			return t.trashNames()
+		case sub == "import":
+			names, _ := t.repoMgr.Scan()
+			return append(names, "--all")
+		}
+	case 2:
+		switch sub {
+		case "adduser":
+			return append(t.userNames(), service.GuestUser)
+		case "deluser":
+			if r := t.repoMgr.Get(args[1]); r != nil {
+				users := make([]string, 0, len(r.Users))
+				for u := range r.Users {
+					users = append(users, u)
+				}
+				return users
+			}
+		case "addkey":
+			return []string{"r", "rw"}
+		case "delkey":
+			if r := t.repoMgr.Get(args[1]); r != nil {
+				keys := make([]string, 0, len(r.DeployKeys))
+				for _, dk := range r.DeployKeys {
+					keys = append(keys, gossh.FingerprintSHA256(dk.Key))
+				}
+				return keys
+			}
+		case "set":
+			return []string{"branch", "description", "owner"}
+		case "fork":
+			return []string{"--owner"}
+		case "delete", "purge":
+			return confirmFlags
+		}
+	case 3:
+		switch {
+		case sub == "deluser", sub == "delkey":
+			return confirmFlags
+		case sub == "adduser":
+			return []string{"maintain", "r", "rw"}
+		case sub == "set" && args[2] == "owner":
+			return append(t.userNames(), "-")
+		case sub == "fork" && args[2] == "--owner":
+			return t.userNames()
+		}
+	}
+	return nil
+}
+
+// userCandidates completes the arguments of "user"
+func (t *TUI) userCandidates(args []string) []string {
+	if len(args) == 0 {
+		return userCommands
+	}
+	sub := args[0]
+	switch len(args) {
+	case 1:
+		if userNameCommands[sub] {
+			return t.userNames()
+		}
+	case 2:
+		switch sub {
+		case "delkey", "expirekey":
+			if user := t.authMgr.GetUser(args[1]); user != nil {
+				keys := make([]string, 0, len(user.Keys))
+				for _, k := range user.Keys {
+					keys = append(keys, k.Fingerprint())
+				}
+				return keys
+			}
+		case "delete":
+			return append([]string{"--cascade"}, confirmFlags...)
+		case "addkey":
+			return []string{"--expires"}
+		case "role":
+			return []string{"admin", "none"}
+		}
+	case 3:
+		switch sub {
+		case "expirekey":
+			return []string{"never"}
+		case "delete", "delkey":
+			return confirmFlags
+		}
+	}
+	return nil
+}
+
+// adminCandidates completes the arguments of "admin"
+func (t *TUI) adminCandidates(args []string) []string {
+	switch {
+	case len(args) == 0:
+		return []string{"add", "delkey", "list", "remove"}
+	case len(args) == 1 && args[0] != "list":
+		admins := t.authMgr.ListAdmins()
+		names := make([]string, 0, len(admins))
+		for _, a := range admins {
+			names = append(names, a.Name)
+		}
+		return names
+	case len(args) == 2 && args[0] == "delkey":
+		if a := t.authMgr.GetAdmin(args[1]); a != nil {
+			keys := make([]string, 0, len(a.Keys))
+			for _, k := range a.Keys {
+				keys = append(keys, k.Fingerprint())
+			}
+			return keys
+		}
+	case len(args) == 2 && args[0] == "remove", len(args) == 3 && args[0] == "delkey":
+		return confirmFlags
+	}
+	return nil
+}
+
+// tokenCandidates completes the arguments of "token"
+func (t *TUI) tokenCandidates(args []string) []string {
+	switch {
+	case len(args) == 0:
+		return []string{"create", "list", "revoke"}
+	case len(args) == 1 && args[0] == "revoke":
+		tokens := t.tokens.List()
+		ids := make([]string, 0, len(tokens))
+		for _, tok := range tokens {
+			ids = append(ids, tok.ID)
+		}
+		return ids
+	case len(args) == 2 && args[0] == "create":
+		return []string{"--expires"}
+	case len(args) == 2 && args[0] == "revoke":
+		return confirmFlags
+	}
+	return nil
+}
+
+// repoNames returns the names of all repositories
+func (t *TUI) repoNames() []string {
+	repos := t.repoMgr.List()
+	names := make([]string, 0, len(repos))
+	for _, r := range repos {
+		names = append(names, r.Name)
+	}
+	return names
+}
+
+// userNames returns the names of all users
+func (t *TUI) userNames() []string {
+	users := t.authMgr.ListUsers()
+	names := make([]string, 0, len(users))
+	for _, u := range users {
+		names = append(names, u.Name)
+	}
+	return names
+}
+
+// trashNames returns the names of the repositories in the trash
+func (t *TUI) trashNames() []string {
+	entries := t.repoMgr.ListTrash()
+	names := make([]string, 0, len(entries))
+	for _, e := range entries {
+		names = append(names, e.Repo.Name)
+	}
+	return names
+}
+
+// matchPrefix returns the sorted, distinct candidates starting with prefix
+func matchPrefix(candidates []string, prefix string) []string {
+	seen := make(map[string]bool, len(candidates))
+	matches := make([]string, 0)
+	for _, c := range candidates {
+		if strings.HasPrefix(c, prefix) && !seen[c] {
+			seen[c] = true
+			matches = append(matches, c)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
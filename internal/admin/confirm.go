@@ -0,0 +1,209 @@
+package admin
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/touken928/gitlite/internal/auth"
+	"github.com/touken928/gitlite/internal/repo"
+	"github.com/touken928/gitlite/internal/service"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// Actions of the changes listed by --dry-run and before confirming
+const (
+	actionTrashRepo       = "trash_repo"        // Repository is moved to the trash
+	actionPurgeRepo       = "purge_repo"        // Trashed repository is deleted for good
+	actionRevokeGrant     = "revoke_grant"      // User loses access to a repository
+	actionRemoveKey       = "remove_key"        // SSH key is removed from a user
+	actionDeleteUser      = "delete_user"       // User account is deleted
+	actionClearOwner      = "clear_owner"       // Repository no longer has an owner
+	actionRemoveDeployKey = "remove_deploy_key" // Deploy key stops working for a repository
+	actionRemoveAdmin     = "remove_admin"      // Administrator is removed
+	actionRemoveAdminKey  = "remove_admin_key"  // SSH key is removed from an administrator
+	actionRevokeToken     = "revoke_token"      // HTTP API token is revoked
+)
+
+// confirmFlags are the flags accepted by destructive commands
+var confirmFlags = []string{"--dry-run", "--yes"}
+
+// confirmOptions holds the confirmation flags given to a destructive command
+type confirmOptions struct {
+	dryRun bool   // Only list the changes
+	yes    bool   // Skip the confirmation
+	typed  string // Text the admin has to type instead of y, if any
+}
+
+// cutConfirmFlags removes --dry-run and --yes from the arguments
+func cutConfirmFlags(args []string) ([]string, confirmOptions) {
+	var opts confirmOptions
+	args, opts.dryRun = cutFlag(args, "--dry-run")
+	args, opts.yes = cutFlag(args, "--yes")
+	return args, opts
+}
+
+// confirm lists the changes of a destructive command and reports whether
+// to go ahead. A dry run only lists them. Otherwise the admin is asked at
+// the terminal, while scripts have to pass --yes.
+func (t *TUI) confirm(opts confirmOptions, changes []changeJSON) bool {
+	if opts.dryRun {
+		t.writePlan(changes)
+		t.writeln(t.msg.DryRunDone)
+		t.result(planJSON{DryRun: true, Changes: changes})
+		return false
+	}
+	if opts.yes || len(changes) == 0 {
+		return true
+	}
+	if !t.interactive {
+		t.fail(codeConfirmRequired, t.msg.ConfirmNeeded)
+		t.result(planJSON{Changes: changes})
+		return false
+	}
+
+	t.writeln(t.msg.PlanIntro)
+	t.writePlan(changes)
+	if opts.typed != "" {
+		// Require the name to be typed again so a typo cannot delete a repository
+		answer, err := t.readLine(t.msg.RepoDeleteConfirm)
+		if err != nil {
+			t.fail(codeAborted, t.msg.RepoDeleteAborted)
+			return false
+		}
+		if strings.TrimSpace(answer) != opts.typed {
+			t.fail(codeAborted, t.msg.RepoDeleteAborted)
+			return false
+		}
+		return true
+	}
+	answer, err := t.readLine(t.msg.ConfirmPrompt)
+	if err != nil {
+		t.fail(codeAborted, t.msg.ConfirmAborted)
+		return false
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	t.fail(codeAborted, t.msg.ConfirmAborted)
+	return false
+}
+
+// writePlan writes one line per change
+func (t *TUI) writePlan(changes []changeJSON) {
+	if len(changes) == 0 {
+		t.writeln(t.msg.PlanNoChanges)
+		return
+	}
+	for _, c := range changes {
+		switch c.Action {
+		case actionTrashRepo:
+			t.writeln(fmt.Sprintf(t.msg.PlanTrashRepo, c.Repo, c.Path, repo.FormatSize(c.Size)))
+		case actionPurgeRepo:
+			t.writeln(fmt.Sprintf(t.msg.PlanPurgeRepo, c.Repo, c.Path, repo.FormatSize(c.Size)))
+		case actionRevokeGrant:
+			t.writeln(fmt.Sprintf(t.msg.PlanRevokeGrant, c.User, c.Perm, c.Repo))
+		case actionRemoveKey:
+			t.writeln(fmt.Sprintf(t.msg.PlanRemoveKey, c.Fingerprint, c.Comment, c.User))
+		case actionDeleteUser:
+			t.writeln(fmt.Sprintf(t.msg.PlanDeleteUser, c.User))
+		case actionClearOwner:
+			t.writeln(fmt.Sprintf(t.msg.PlanClearOwner, c.User, c.Repo))
+		case actionRemoveDeployKey:
+			t.writeln(fmt.Sprintf(t.msg.PlanRemoveDeployKey, c.Fingerprint, c.Perm, c.Repo))
+		case actionRemoveAdmin:
+			t.writeln(fmt.Sprintf(t.msg.PlanRemoveAdmin, c.Admin))
+		case actionRemoveAdminKey:
+			t.writeln(fmt.Sprintf(t.msg.PlanRemoveAdminKey, c.Fingerprint, c.Comment, c.Admin))
+		case actionRevokeToken:
+			t.writeln(fmt.Sprintf(t.msg.PlanRevokeToken, c.Token, c.Comment))
+		}
+	}
+}
+
+// revokeChanges lists grants that are revoked
+func revokeChanges(grants []service.Grant) []changeJSON {
+	changes := make([]changeJSON, 0, len(grants))
+	for _, g := range grants {
+		changes = append(changes, changeJSON{Action: actionRevokeGrant, Repo: g.Repo, User: g.User, Perm: g.Perm.String()})
+	}
+	return changes
+}
+
+// keyChange lists a user key that is removed
+func keyChange(userName string, k *auth.Key) changeJSON {
+	return changeJSON{Action: actionRemoveKey, User: userName, Fingerprint: k.Fingerprint(), Comment: k.Comment}
+}
+
+// deployKeyChange lists a deploy key that stops working for a repository
+func deployKeyChange(repoName string, dk *repo.DeployKey) changeJSON {
+	return changeJSON{Action: actionRemoveDeployKey, Repo: repoName, Fingerprint: gossh.FingerprintSHA256(dk.Key), Perm: dk.Perm.String()}
+}
+
+// adminKeyChange lists a key that is removed from an administrator
+func adminKeyChange(adminName string, k *auth.Key) changeJSON {
+	return changeJSON{Action: actionRemoveAdminKey, Admin: adminName, Fingerprint: k.Fingerprint(), Comment: k.Comment}
+}
+
+// repoDeleteChanges lists what deleting a repository changes: its
+// directory moves to the trash and its grants and deploy keys go with it
+func (t *TUI) repoDeleteChanges(r *repo.Repository) []changeJSON {
+	size, _ := t.repoMgr.Size(r.Name)
+	grants := make([]service.Grant, 0, len(r.Users))
+	for u, p := range r.Users {
+		grants = append(grants, service.Grant{Repo: r.Name, User: u, Perm: p})
+	}
+	sort.Slice(grants, func(i, j int) bool { return grants[i].User < grants[j].User })
+
+	changes := []changeJSON{{Action: actionTrashRepo, Repo: r.Name, Path: r.Path, Size: size}}
+	changes = append(changes, revokeChanges(grants)...)
+	for _, dk := range r.DeployKeys {
+		changes = append(changes, deployKeyChange(r.Name, dk))
+	}
+	return changes
+}
+
+// userDeleteChanges lists what deleting a user changes, as planned by the
+// service
+func (t *TUI) userDeleteChanges(user *auth.User, plan *service.UserDeletion) []changeJSON {
+	changes := []changeJSON{{Action: actionDeleteUser, User: user.Name}}
+	for _, k := range user.Keys {
+		changes = append(changes, keyChange(user.Name, k))
+	}
+	changes = append(changes, revokeChanges(plan.Grants)...)
+	for _, name := range plan.Owned {
+		changes = append(changes, changeJSON{Action: actionClearOwner, Repo: name, User: user.Name})
+	}
+	return changes
+}
+
+// adminRemoveChanges lists what removing an administrator changes
+func adminRemoveChanges(admin *auth.User) []changeJSON {
+	changes := []changeJSON{{Action: actionRemoveAdmin, Admin: admin.Name}}
+	for _, k := range admin.Keys {
+		changes = append(changes, adminKeyChange(admin.Name, k))
+	}
+	return changes
+}
+
+// purgeChanges lists the trash entries "repo purge" removes
+func (t *TUI) purgeChanges(args []string) []changeJSON {
+	var entries []*repo.TrashEntry
+	switch {
+	case len(args) < 2:
+		entries = t.repoMgr.ListTrashExpired(time.Now())
+	case args[1] == "--all":
+		entries = t.repoMgr.ListTrashNamed("")
+	default:
+		entries = t.repoMgr.ListTrashNamed(args[1])
+	}
+	changes := make([]changeJSON, 0, len(entries))
+	for _, e := range entries {
+		size, _ := t.repoMgr.TrashEntrySize(e)
+		changes = append(changes, changeJSON{Action: actionPurgeRepo, Repo: e.Repo.Name, Path: t.repoMgr.TrashEntryPath(e), Size: size})
+	}
+	return changes
+}
@@ -0,0 +1,49 @@
+package admin
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxHistory is the number of commands kept in the history of each administrator
+const maxHistory = 1000
+
+// historyPath returns the file holding the command history of the administrator
+func (t *TUI) historyPath() string {
+	return filepath.Join(t.dataPath, "history", t.actor)
+}
+
+// loadHistory reads a command history file, oldest command first. Files
+// that grew beyond maxHistory commands are cut back to the latest ones.
+func loadHistory(path string) []string {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+	if len(lines) == 1 && lines[0] == "" {
+		return nil
+	}
+	if len(lines) > maxHistory {
+		lines = lines[len(lines)-maxHistory:]
+		os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+	}
+	return lines
+}
+
+// appendHistory adds a command to a history file
+func appendHistory(path, line string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(line + "\n"); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
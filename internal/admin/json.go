@@ -0,0 +1,269 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/touken928/gitlite/internal/auth"
+	"github.com/touken928/gitlite/internal/backup"
+	"github.com/touken928/gitlite/internal/dto"
+	"github.com/touken928/gitlite/internal/repo"
+	"github.com/touken928/gitlite/internal/service"
+	"github.com/touken928/gitlite/internal/storage"
+)
+
+// Error codes of JSON responses. They are part of the output format and
+// must not change, unlike the localized messages that accompany them.
+const (
+	codeUsage             = "usage"                 // Missing or extra arguments
+	codeUnknownCommand    = "unknown_command"       // Command or subcommand does not exist
+	codeInvalidArgument   = "invalid_argument"      // Argument could not be parsed
+	codeRepoNotFound      = "repo_not_found"        // Repository does not exist
+	codeRepoExists        = "repo_exists"           // Repository name is taken
+	codeUserNotFound      = "user_not_found"        // User does not exist
+	codeUserExists        = "user_exists"           // User name is taken
+	codeKeyNotFound       = "key_not_found"         // Key with the fingerprint does not exist
+	codeKeyExists         = "key_exists"            // User already has the key
+	codeKeyInUse          = "key_in_use"            // Key belongs to another user or deploy key
+	codeGuestReserved     = "guest_reserved"        // Guest user cannot be created or deleted
+	codeGuestReadOnly     = "guest_read_only"       // Guest user cannot get write access
+	codeUserHasGrants     = "user_has_grants"       // User still has grants, see --cascade
+	codeTokenNotFound     = "token_not_found"       // API token with the ID does not exist
+	codeAdminNotFound     = "admin_not_found"       // Administrator does not exist
+	codeLastAdmin         = "last_admin"            // Change would leave no administrator able to log in
+	codeAborted           = "aborted"               // Confirmation did not match
+	codeConfirmRequired   = "confirmation_required" // Destructive command run by a script without --yes
+	codeMaintenanceFailed = "maintenance_failed"    // gc or fsck reported an error
+	codeSaveFailed        = "save_failed"           // Data could not be written to disk
+	codeFailed            = "failed"                // Any other error
+)
+
+// response is the JSON document written for each command in JSON mode
+type response struct {
+	OK      bool           `json:"ok"`              // Whether the command succeeded
+	Command string         `json:"command"`         // Command that was run, such as "repo list"
+	Data    any            `json:"data,omitempty"`  // Command specific result
+	Error   *responseError `json:"error,omitempty"` // Set when the command failed
+}
+
+// responseError describes why a command failed
+type responseError struct {
+	Code    string `json:"code"`    // Stable error code
+	Message string `json:"message"` // Localized message
+}
+
+// repoInfoJSON adds the details shown by "repo info"
+type repoInfoJSON struct {
+	dto.Repo
+	Path          string               `json:"path"`
+	Size          int64                `json:"size"`
+	DefaultBranch string               `json:"default_branch,omitempty"`
+	Aliases       map[string]time.Time `json:"aliases,omitempty"`
+}
+
+// templateJSON describes a repository template
+type templateJSON struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// trashJSON describes a deleted repository in the trash
+type trashJSON struct {
+	Name      string     `json:"name"`
+	DeletedAt time.Time  `json:"deleted_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// changeJSON describes one change a destructive command makes
+type changeJSON struct {
+	Action      string `json:"action"`                // One of the actionXxx values
+	Repo        string `json:"repo,omitempty"`        // Repository affected
+	User        string `json:"user,omitempty"`        // User affected
+	Admin       string `json:"admin,omitempty"`       // Administrator affected
+	Token       string `json:"token,omitempty"`       // ID of a revoked API token
+	Perm        string `json:"perm,omitempty"`        // Permission of a revoked grant or deploy key
+	Fingerprint string `json:"fingerprint,omitempty"` // Fingerprint of a removed key
+	Comment     string `json:"comment,omitempty"`     // Comment of a removed key, or name of a revoked token
+	Path        string `json:"path,omitempty"`        // Directory moved or removed
+	Size        int64  `json:"size,omitempty"`        // Size of that directory in bytes
+}
+
+// planJSON lists the changes of a destructive command that was not run
+type planJSON struct {
+	DryRun  bool         `json:"dry_run"`
+	Changes []changeJSON `json:"changes"`
+}
+
+// lfsObjectJSON describes an LFS object
+type lfsObjectJSON struct {
+	OID      string `json:"oid"`
+	Size     int64  `json:"size"`
+	Orphaned bool   `json:"orphaned"`
+}
+
+// maintenanceJSON is the result of "repo gc" and "repo fsck"
+type maintenanceJSON struct {
+	Name       string          `json:"name"`
+	Task       string          `json:"task"`
+	OK         bool            `json:"ok"`
+	DurationMs int64           `json:"duration_ms"`
+	Message    string          `json:"message,omitempty"`
+	Before     objectStatsJSON `json:"before"`
+	After      objectStatsJSON `json:"after"`
+}
+
+// objectStatsJSON counts the objects of a repository
+type objectStatsJSON struct {
+	Loose int64 `json:"loose"`
+	Packs int64 `json:"packs"`
+}
+
+// lfsGCJSON is the result of "repo lfsgc"
+type lfsGCJSON struct {
+	Removed int   `json:"removed"`
+	Freed   int64 `json:"freed"`
+}
+
+// fsckJSON is the result of "fsck"
+type fsckJSON struct {
+	Dangling []dto.Grant `json:"dangling"`
+	Fixed    int         `json:"fixed"`
+}
+
+// backupJSON is the result of "backup"
+type backupJSON struct {
+	Path     string           `json:"path"`
+	Manifest *backup.Manifest `json:"manifest"`
+}
+
+// staleKeyJSON is a key listed by "user stalekeys"
+type staleKeyJSON struct {
+	User string `json:"user"`
+	dto.Key
+}
+
+// adminJSON describes an administrator
+type adminJSON struct {
+	Name string    `json:"name"`
+	Keys []dto.Key `json:"keys"`
+	Self bool      `json:"self"` // Whether this is the administrator running the command
+}
+
+// tokenJSON describes an HTTP API token
+type tokenJSON struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name,omitempty"`
+	Token     string     `json:"token,omitempty"` // Secret, only returned when the token is issued
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	CreatedBy string     `json:"created_by,omitempty"`
+	LastUsed  *time.Time `json:"last_used,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Expired   bool       `json:"expired"`
+}
+
+// nameJSON is the result of commands that create, change or delete one object
+type nameJSON struct {
+	Name     string      `json:"name"`
+	From     string      `json:"from,omitempty"`     // Former name of a renamed repository
+	Warnings []string    `json:"warnings,omitempty"` // Problems that did not stop the command
+	Revoked  []dto.Grant `json:"revoked,omitempty"`  // Grants revoked along the way
+}
+
+// commandName returns the command and subcommand of args for JSON responses
+func commandName(args []string) string {
+	if len(args) > 1 && (args[0] == "repo" || args[0] == "user" || args[0] == "token" || args[0] == "admin") {
+		return args[0] + " " + args[1]
+	}
+	return args[0]
+}
+
+// errorCode maps errors of the managers to stable error codes
+func errorCode(err error) string {
+	var repoNotFound *repo.NotFoundError
+	var repoExists *repo.ExistsError
+	var userNotFound *auth.UserNotFoundError
+	var userExists *auth.UserExistsError
+	var nameTaken *auth.NameTakenError
+	var adminNotFound *auth.AdminNotFoundError
+	switch {
+	case errors.As(err, &repoNotFound):
+		return codeRepoNotFound
+	case errors.As(err, &repoExists):
+		return codeRepoExists
+	case errors.As(err, &userNotFound):
+		return codeUserNotFound
+	case errors.As(err, &userExists), errors.As(err, &nameTaken):
+		return codeUserExists
+	case errors.As(err, &adminNotFound):
+		return codeAdminNotFound
+	case errors.Is(err, auth.ErrLastAdmin):
+		return codeLastAdmin
+	case errors.Is(err, auth.ErrKeyNotFound), errors.Is(err, repo.ErrKeyNotFound):
+		return codeKeyNotFound
+	case errors.Is(err, auth.ErrKeyExists):
+		return codeKeyExists
+	case errors.Is(err, auth.ErrTokenNotFound):
+		return codeTokenNotFound
+	case errors.Is(err, service.ErrUserHasGrants):
+		return codeUserHasGrants
+	case errors.Is(err, service.ErrGuestReserved):
+		return codeGuestReserved
+	case errors.Is(err, service.ErrGuestReadOnly):
+		return codeGuestReadOnly
+	case errors.Is(err, service.ErrKeyInUse):
+		return codeKeyInUse
+	}
+	return codeFailed
+}
+
+// exitStatus returns the exit status of a command that failed with code
+func exitStatus(code string) int {
+	switch code {
+	case codeUsage, codeUnknownCommand, codeInvalidArgument:
+		return exitUsage
+	}
+	return exitFailed
+}
+
+// toTrashJSON converts a trash entry for JSON output
+func toTrashJSON(e *repo.TrashEntry) trashJSON {
+	return trashJSON{Name: e.Repo.Name, DeletedAt: e.DeletedAt, ExpiresAt: storage.TimePtr(e.ExpiresAt)}
+}
+
+// resultRepo sets the current state of a repository as the JSON result
+func (t *TUI) resultRepo(name string) {
+	if r := t.repoMgr.Get(name); r != nil {
+		t.result(dto.ToRepo(r))
+	}
+}
+
+// toTokenJSON converts an API token for JSON output
+func toTokenJSON(tok *auth.Token) tokenJSON {
+	return tokenJSON{
+		ID:        tok.ID,
+		Name:      tok.Name,
+		CreatedAt: storage.TimePtr(tok.CreatedAt),
+		CreatedBy: tok.CreatedBy,
+		LastUsed:  storage.TimePtr(tok.LastUsed),
+		ExpiresAt: storage.TimePtr(tok.ExpiresAt),
+		Expired:   tok.Expired(time.Now()),
+	}
+}
+
+// writeResponse writes the JSON response of the current command
+func (t *TUI) writeResponse() {
+	resp := t.response
+	t.response = nil
+	resp.OK = resp.Error == nil
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(resp); err != nil {
+		buf.Reset()
+		enc.Encode(&response{Command: resp.Command, Error: &responseError{Code: codeFailed, Message: err.Error()}})
+	}
+	t.writeln(strings.TrimSuffix(buf.String(), "\n"))
+}
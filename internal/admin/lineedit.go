@@ -0,0 +1,406 @@
+package admin
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Control keys understood by the line editor
+const (
+	keyCtrlA     = 1
+	keyCtrlB     = 2
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyCtrlF     = 6
+	keyBackspace = 8
+	keyTab       = 9
+	keyCtrlK     = 11
+	keyCtrlL     = 12
+	keyCtrlN     = 14
+	keyCtrlP     = 16
+	keyCtrlU     = 21
+	keyCtrlW     = 23
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// completer returns the candidates for the word ending at the cursor, given
+// the words before it
+type completer func(words []string, word string) []string
+
+// lineEditor reads lines from a terminal with cursor movement, history and
+// tab completion. Input is UTF-8; the cursor position accounts for wide
+// characters and lines wrapping at the terminal width.
+type lineEditor struct {
+	in       *bufio.Reader // Terminal input
+	out      io.Writer     // Terminal output
+	mu       sync.Mutex    // Guards width
+	width    int           // Terminal width in columns
+	history  []string      // Entered lines, oldest first
+	complete completer     // Tab completion, nil disables it
+
+	// State of the line being edited
+	prompt string // Prompt shown before the line
+	line   []rune // Line content
+	pos    int    // Cursor position in line
+	row    int    // Screen row of the cursor relative to the prompt
+}
+
+// newLineEditor creates a line editor for a terminal of the given width
+func newLineEditor(in io.Reader, out io.Writer, width int) *lineEditor {
+	e := &lineEditor{in: bufio.NewReader(in), out: out}
+	e.setWidth(width)
+	return e
+}
+
+// setWidth updates the terminal width after a window change
+func (e *lineEditor) setWidth(width int) {
+	if width <= 0 {
+		width = 80
+	}
+	e.mu.Lock()
+	e.width = width
+	e.mu.Unlock()
+}
+
+// termWidth returns the current terminal width
+func (e *lineEditor) termWidth() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.width
+}
+
+// readLine shows prompt and reads one line. With useHistory, the up and
+// down keys browse earlier lines and tab completes words. Ctrl+C discards
+// the line, Ctrl+D on an empty line returns io.EOF.
+func (e *lineEditor) readLine(prompt string, useHistory bool) (string, error) {
+	e.prompt, e.line, e.pos, e.row = prompt, nil, 0, 0
+	io.WriteString(e.out, prompt)
+
+	histPos := len(e.history)
+	var pending []rune // Line being edited while browsing history
+
+	for {
+		r, err := e.readRune()
+		if err != nil {
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			e.moveToEnd()
+			io.WriteString(e.out, "\r\n")
+			line := string(e.line)
+			entry := strings.TrimSpace(line)
+			if useHistory && entry != "" && (len(e.history) == 0 || e.history[len(e.history)-1] != entry) {
+				e.history = append(e.history, entry)
+			}
+			return line, nil
+		case keyCtrlC:
+			e.moveToEnd()
+			io.WriteString(e.out, "^C\r\n")
+			return "", nil
+		case keyCtrlD:
+			if len(e.line) == 0 {
+				io.WriteString(e.out, "\r\n")
+				return "", io.EOF
+			}
+			e.deleteAt(e.pos)
+		case keyBackspace, keyDelete:
+			if e.pos > 0 {
+				e.pos--
+				e.deleteAt(e.pos)
+			}
+		case keyCtrlA:
+			e.moveTo(0)
+		case keyCtrlE:
+			e.moveTo(len(e.line))
+		case keyCtrlB:
+			e.moveTo(e.pos - 1)
+		case keyCtrlF:
+			e.moveTo(e.pos + 1)
+		case keyCtrlK:
+			e.line = e.line[:e.pos]
+			e.refresh()
+		case keyCtrlU:
+			e.line = append([]rune{}, e.line[e.pos:]...)
+			e.pos = 0
+			e.refresh()
+		case keyCtrlW:
+			start := e.pos
+			for start > 0 && e.line[start-1] == ' ' {
+				start--
+			}
+			for start > 0 && e.line[start-1] != ' ' {
+				start--
+			}
+			e.line = append(e.line[:start], e.line[e.pos:]...)
+			e.pos = start
+			e.refresh()
+		case keyCtrlL:
+			io.WriteString(e.out, "\x1b[H\x1b[2J")
+			e.row = 0
+			io.WriteString(e.out, e.prompt)
+			e.refresh()
+		case keyCtrlP, keyCtrlN:
+			if useHistory {
+				histPos, pending = e.browse(r == keyCtrlP, histPos, pending)
+			}
+		case keyTab:
+			if useHistory && e.complete != nil {
+				e.completeWord()
+			}
+		case keyEscape:
+			key, err := e.readEscape()
+			if err != nil {
+				return "", err
+			}
+			switch key {
+			case 'A', 'B':
+				if useHistory {
+					histPos, pending = e.browse(key == 'A', histPos, pending)
+				}
+			case 'C':
+				e.moveTo(e.pos + 1)
+			case 'D':
+				e.moveTo(e.pos - 1)
+			case 'H':
+				e.moveTo(0)
+			case 'F':
+				e.moveTo(len(e.line))
+			case '~':
+				if e.pos < len(e.line) {
+					e.deleteAt(e.pos)
+				}
+			}
+		default:
+			if r != utf8.RuneError && unicode.IsPrint(r) {
+				e.line = append(e.line[:e.pos], append([]rune{r}, e.line[e.pos:]...)...)
+				e.pos++
+				e.refresh()
+			}
+		}
+	}
+}
+
+// readRune reads one UTF-8 encoded character. Invalid bytes are returned
+// as utf8.RuneError, which the editor ignores.
+func (e *lineEditor) readRune() (rune, error) {
+	r, _, err := e.in.ReadRune()
+	return r, err
+}
+
+// readEscape reads the rest of an escape sequence and returns a key:
+// 'A' to 'D' for the arrow keys, 'H' and 'F' for home and end, '~' for
+// delete, or 0 for sequences that are ignored. Terminals send a sequence
+// in one write, so an Esc with nothing buffered after it is a lone Esc key,
+// and a byte other than '[' or 'O' after it is left for the next key.
+func (e *lineEditor) readEscape() (byte, error) {
+	if e.in.Buffered() == 0 {
+		return 0, nil
+	}
+	b, err := e.in.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b != '[' && b != 'O' {
+		e.in.UnreadByte()
+		return 0, nil
+	}
+
+	// Parameters such as "1;5" precede the final byte of the sequence
+	var params []byte
+	for {
+		c, err := e.in.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if c >= 0x40 && c <= 0x7e {
+			switch {
+			case c != '~':
+				return c, nil
+			case string(params) == "3":
+				return '~', nil
+			case string(params) == "1" || string(params) == "7":
+				return 'H', nil
+			case string(params) == "4" || string(params) == "8":
+				return 'F', nil
+			}
+			return 0, nil
+		}
+		params = append(params, c)
+	}
+}
+
+// browse replaces the line with an older (up) or newer entry from history.
+// The line being edited is kept in pending and returns after the newest entry.
+func (e *lineEditor) browse(up bool, histPos int, pending []rune) (int, []rune) {
+	if up {
+		if histPos == 0 {
+			return histPos, pending
+		}
+		if histPos == len(e.history) {
+			pending = append([]rune{}, e.line...)
+		}
+		histPos--
+		e.line = []rune(e.history[histPos])
+	} else {
+		if histPos >= len(e.history) {
+			return histPos, pending
+		}
+		histPos++
+		if histPos == len(e.history) {
+			e.line = pending
+		} else {
+			e.line = []rune(e.history[histPos])
+		}
+	}
+	e.pos = len(e.line)
+	e.refresh()
+	return histPos, pending
+}
+
+// completeWord completes the word ending at the cursor. A single candidate
+// is inserted, several are completed to their common prefix or listed.
+func (e *lineEditor) completeWord() {
+	start := e.pos
+	for start > 0 && e.line[start-1] != ' ' {
+		start--
+	}
+	word := string(e.line[start:e.pos])
+	candidates := e.complete(strings.Fields(string(e.line[:start])), word)
+	if len(candidates) == 0 {
+		return
+	}
+
+	insert := commonPrefix(candidates)
+	if len(candidates) == 1 {
+		insert += " "
+	}
+	if insert == word && len(candidates) > 1 {
+		// Nothing to add, show the choices below the line
+		e.moveToEnd()
+		io.WriteString(e.out, "\r\n"+strings.Join(candidates, "  ")+"\r\n")
+		e.row = 0
+		io.WriteString(e.out, e.prompt)
+		e.refresh()
+		return
+	}
+	rest := append([]rune(insert), e.line[e.pos:]...)
+	e.line = append(e.line[:start], rest...)
+	e.pos = start + utf8.RuneCountInString(insert)
+	e.refresh()
+}
+
+// deleteAt removes the character at index i
+func (e *lineEditor) deleteAt(i int) {
+	if i < 0 || i >= len(e.line) {
+		return
+	}
+	e.line = append(e.line[:i], e.line[i+1:]...)
+	e.refresh()
+}
+
+// moveTo moves the cursor to index i of the line
+func (e *lineEditor) moveTo(i int) {
+	if i < 0 || i > len(e.line) || i == e.pos {
+		return
+	}
+	e.pos = i
+	e.refresh()
+}
+
+// moveToEnd puts the terminal cursor after the last character of the line
+func (e *lineEditor) moveToEnd() {
+	e.pos = len(e.line)
+	e.refresh()
+}
+
+// refresh redraws the prompt and line and places the cursor. Rows are
+// counted from the prompt, so lines longer than the terminal are handled.
+func (e *lineEditor) refresh() {
+	width := e.termWidth()
+	var b strings.Builder
+
+	// Back to the start of the prompt
+	if e.row > 0 {
+		fmt.Fprintf(&b, "\x1b[%dA", e.row)
+	}
+	b.WriteString("\r")
+	b.WriteString(e.prompt)
+	b.WriteString(string(e.line))
+	b.WriteString("\x1b[J")
+
+	// A line ending exactly at the right margin leaves the cursor there
+	// until the next character, so move it down explicitly
+	promptWidth := textWidth([]rune(e.prompt))
+	end := promptWidth + textWidth(e.line)
+	if end > 0 && end%width == 0 {
+		b.WriteString("\r\n")
+	}
+
+	cursor := promptWidth + textWidth(e.line[:e.pos])
+	endRow, cursorRow := end/width, cursor/width
+	if endRow > cursorRow {
+		fmt.Fprintf(&b, "\x1b[%dA", endRow-cursorRow)
+	}
+	b.WriteString("\r")
+	if col := cursor % width; col > 0 {
+		fmt.Fprintf(&b, "\x1b[%dC", col)
+	}
+	e.row = cursorRow
+
+	io.WriteString(e.out, b.String())
+}
+
+// commonPrefix returns the longest prefix shared by all strings
+func commonPrefix(s []string) string {
+	prefix := s[0]
+	for _, c := range s[1:] {
+		for !strings.HasPrefix(c, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+	return prefix
+}
+
+// textWidth returns the number of terminal columns the runes occupy
+func textWidth(runes []rune) int {
+	n := 0
+	for _, r := range runes {
+		n += runeWidth(r)
+	}
+	return n
+}
+
+// runeWidth returns the number of terminal columns a character occupies:
+// 0 for combining marks, 2 for East Asian wide characters and emoji
+func runeWidth(r rune) int {
+	switch {
+	case unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf):
+		return 0
+	case r >= 0x1100 && r <= 0x115f,
+		r >= 0x2e80 && r <= 0x303e,
+		r >= 0x3041 && r <= 0x33ff,
+		r >= 0x3400 && r <= 0x4dbf,
+		r >= 0x4e00 && r <= 0x9fff,
+		r >= 0xa000 && r <= 0xa4cf,
+		r >= 0xac00 && r <= 0xd7a3,
+		r >= 0xf900 && r <= 0xfaff,
+		r >= 0xfe30 && r <= 0xfe4f,
+		r >= 0xff00 && r <= 0xff60,
+		r >= 0xffe0 && r <= 0xffe6,
+		r >= 0x1f300 && r <= 0x1f64f,
+		r >= 0x1f900 && r <= 0x1f9ff,
+		r >= 0x20000 && r <= 0x3fffd:
+		return 2
+	}
+	return 1
+}
@@ -0,0 +1,295 @@
+// Package api serves the HTTP admin API. It exposes the same user, key,
+// repository and grant operations as the admin TUI, authenticated with
+// bearer tokens issued from the TUI.
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/touken928/gitlite/internal/audit"
+	"github.com/touken928/gitlite/internal/auth"
+	"github.com/touken928/gitlite/internal/logging"
+	"github.com/touken928/gitlite/internal/repo"
+	"github.com/touken928/gitlite/internal/service"
+)
+
+// Prefix is the path below which the API is served
+const Prefix = "/api/v1/"
+
+// maxBodySize limits the size of request bodies
+const maxBodySize = 1 << 20
+
+// Server is the HTTP admin API
+type Server struct {
+	httpSrv  *http.Server       // HTTP server instance
+	certFile string             // TLS certificate, empty serves plain HTTP
+	keyFile  string             // TLS private key
+	authMgr  auth.AuthManager   // User authentication manager interface
+	repoMgr  repo.RepoManager   // Repository manager interface
+	tokens   *auth.TokenManager // Bearer tokens accepted by the API
+	svc      *service.Service   // Cross-manager operations
+	dataPath string             // Base directory for data storage
+}
+
+// New creates an API server listening on addr. With certFile and keyFile
+// it serves HTTPS. Without them bearer tokens travel in cleartext, so only
+// a loopback address is accepted.
+func New(addr, certFile, keyFile, dataPath string, authMgr auth.AuthManager, repoMgr repo.RepoManager, tokens *auth.TokenManager) (*Server, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("GITLITE_HTTP_TLS_CERT and GITLITE_HTTP_TLS_KEY must be set together")
+	}
+	if certFile == "" && !isLoopback(addr) {
+		return nil, fmt.Errorf("refusing to serve the HTTP API on %s without TLS, set GITLITE_HTTP_TLS_CERT and GITLITE_HTTP_TLS_KEY or listen on a loopback address", addr)
+	}
+
+	s := &Server{
+		certFile: certFile,
+		keyFile:  keyFile,
+		authMgr:  authMgr,
+		repoMgr:  repoMgr,
+		tokens:   tokens,
+		svc:      service.New(authMgr, repoMgr),
+		dataPath: dataPath,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(Prefix+"openapi.json", s.handleOpenAPI)
+	mux.Handle(Prefix, s.authenticate(http.HandlerFunc(s.route)))
+	s.httpSrv = &http.Server{
+		Addr:              addr,
+		Handler:           mux,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return s, nil
+}
+
+// isLoopback reports whether a listen address only accepts connections
+// from the local machine
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Start begins listening for HTTP requests
+func (s *Server) Start() error {
+	var err error
+	if s.certFile != "" {
+		err = s.httpSrv.ListenAndServeTLS(s.certFile, s.keyFile)
+	} else {
+		err = s.httpSrv.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Addr returns the address the server listens on
+func (s *Server) Addr() string {
+	return s.httpSrv.Addr
+}
+
+// Stop waits briefly for running requests and shuts the server down
+func (s *Server) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.httpSrv.Shutdown(ctx); err != nil {
+		logging.Get().Warn("Failed to shut down HTTP API", zap.Error(err))
+	}
+}
+
+// tokenKey is the context key of the token a request was made with
+type tokenKey struct{}
+
+// authenticate rejects requests without a valid bearer token and logs the
+// requests that were let through
+func (s *Server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		tok, valid := s.tokens.Verify(strings.TrimSpace(value))
+		if !ok || !valid {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gitlite"`)
+			writeError(w, http.StatusUnauthorized, codeUnauthorized, "missing or invalid bearer token")
+			return
+		}
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), tokenKey{}, tok)))
+		logging.Get().Info("API request",
+			zap.String("method", r.Method),
+			zap.String("path", r.URL.EscapedPath()),
+			zap.String("token", tok.ID),
+			zap.Int("status", rec.status))
+
+		// Only requests that may change something are audited
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			remote, _, _ := net.SplitHostPort(r.RemoteAddr)
+			entry := audit.Entry{
+				Actor:   "api:" + tok.Name,
+				Via:     "http",
+				Remote:  remote,
+				Command: r.Method + " " + r.URL.EscapedPath(),
+				OK:      rec.status < http.StatusBadRequest,
+			}
+			if err := audit.Record(s.dataPath, entry); err != nil {
+				logging.Get().Warn("Failed to write audit log", zap.Error(err))
+			}
+		}
+	})
+}
+
+// statusRecorder remembers the status code written to a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int // Status code of the response
+}
+
+// WriteHeader implements http.ResponseWriter
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// actor returns the name recorded as the author of changes made by a request
+func actor(r *http.Request) string {
+	if tok, ok := r.Context().Value(tokenKey{}).(*auth.Token); ok {
+		return "api:" + tok.Name
+	}
+	return "api"
+}
+
+// route dispatches a request by its path. Path segments are unescaped one
+// by one, so repository names containing "/" are sent as "team%2Fapp".
+func (s *Server) route(w http.ResponseWriter, r *http.Request) {
+	rest := strings.TrimPrefix(r.URL.EscapedPath(), Prefix)
+	segments := strings.Split(strings.TrimSuffix(rest, "/"), "/")
+	for i, seg := range segments {
+		unescaped, err := url.PathUnescape(seg)
+		if err != nil || unescaped == "" {
+			writeError(w, http.StatusNotFound, codeNotFound, "no such endpoint")
+			return
+		}
+		segments[i] = unescaped
+	}
+
+	switch {
+	case len(segments) == 1 && segments[0] == "users":
+		s.methods(w, r, handlers{http.MethodGet: s.listUsers, http.MethodPost: s.createUser})
+	case len(segments) == 2 && segments[0] == "users":
+		s.methods(w, r, handlers{
+			http.MethodGet:    func(w http.ResponseWriter, r *http.Request) { s.getUser(w, r, segments[1]) },
+			http.MethodDelete: func(w http.ResponseWriter, r *http.Request) { s.deleteUser(w, r, segments[1]) },
+		})
+	case len(segments) == 3 && segments[0] == "users" && segments[2] == "keys":
+		s.methods(w, r, handlers{
+			http.MethodGet:  func(w http.ResponseWriter, r *http.Request) { s.listUserKeys(w, r, segments[1]) },
+			http.MethodPost: func(w http.ResponseWriter, r *http.Request) { s.addUserKey(w, r, segments[1]) },
+		})
+	case len(segments) == 4 && segments[0] == "users" && segments[2] == "keys":
+		s.methods(w, r, handlers{
+			http.MethodDelete: func(w http.ResponseWriter, r *http.Request) { s.deleteUserKey(w, r, segments[1], segments[3]) },
+		})
+	case len(segments) == 3 && segments[0] == "users" && segments[2] == "grants":
+		s.methods(w, r, handlers{
+			http.MethodGet: func(w http.ResponseWriter, r *http.Request) { s.listUserGrants(w, r, segments[1]) },
+		})
+	case len(segments) == 1 && segments[0] == "repos":
+		s.methods(w, r, handlers{http.MethodGet: s.listRepos, http.MethodPost: s.createRepo})
+	case len(segments) == 2 && segments[0] == "repos":
+		s.methods(w, r, handlers{
+			http.MethodGet:    func(w http.ResponseWriter, r *http.Request) { s.getRepo(w, r, segments[1]) },
+			http.MethodDelete: func(w http.ResponseWriter, r *http.Request) { s.deleteRepo(w, r, segments[1]) },
+		})
+	case len(segments) == 3 && segments[0] == "repos" && segments[2] == "grants":
+		s.methods(w, r, handlers{
+			http.MethodGet: func(w http.ResponseWriter, r *http.Request) { s.listRepoGrants(w, r, segments[1]) },
+		})
+	case len(segments) == 4 && segments[0] == "repos" && segments[2] == "grants":
+		s.methods(w, r, handlers{
+			http.MethodPut:    func(w http.ResponseWriter, r *http.Request) { s.putGrant(w, r, segments[1], segments[3]) },
+			http.MethodDelete: func(w http.ResponseWriter, r *http.Request) { s.deleteGrant(w, r, segments[1], segments[3]) },
+		})
+	case len(segments) == 3 && segments[0] == "repos" && segments[2] == "keys":
+		s.methods(w, r, handlers{
+			http.MethodGet:  func(w http.ResponseWriter, r *http.Request) { s.listDeployKeys(w, r, segments[1]) },
+			http.MethodPost: func(w http.ResponseWriter, r *http.Request) { s.addDeployKey(w, r, segments[1]) },
+		})
+	case len(segments) == 4 && segments[0] == "repos" && segments[2] == "keys":
+		s.methods(w, r, handlers{
+			http.MethodDelete: func(w http.ResponseWriter, r *http.Request) { s.deleteDeployKey(w, r, segments[1], segments[3]) },
+		})
+	default:
+		writeError(w, http.StatusNotFound, codeNotFound, "no such endpoint")
+	}
+}
+
+// handlers maps HTTP methods to the handlers of one endpoint
+type handlers map[string]http.HandlerFunc
+
+// methods calls the handler for the request method, or answers 405
+func (s *Server) methods(w http.ResponseWriter, r *http.Request, h handlers) {
+	if handler, ok := h[r.Method]; ok {
+		handler(w, r)
+		return
+	}
+	allowed := make([]string, 0, len(h))
+	for m := range h {
+		allowed = append(allowed, m)
+	}
+	sort.Strings(allowed)
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, "method not allowed")
+}
+
+// save persists user and repository data to disk, like the admin TUI does
+// after every change. The change stays in effect if saving fails.
+func (s *Server) save(w http.ResponseWriter) bool {
+	if err := s.authMgr.SaveToFile(filepath.Join(s.dataPath, "users.json")); err != nil {
+		writeError(w, http.StatusInternalServerError, codeSaveFailed, err.Error())
+		return false
+	}
+	if err := s.repoMgr.SaveToFile(filepath.Join(s.dataPath, "repos.json")); err != nil {
+		writeError(w, http.StatusInternalServerError, codeSaveFailed, err.Error())
+		return false
+	}
+	return true
+}
+
+// decode reads a JSON request body into v, rejecting unknown fields
+func decode(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidArgument, "invalid request body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	enc.Encode(v)
+}
@@ -0,0 +1,88 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/touken928/gitlite/internal/auth"
+	"github.com/touken928/gitlite/internal/dto"
+	"github.com/touken928/gitlite/internal/repo"
+	"github.com/touken928/gitlite/internal/service"
+)
+
+// Error codes of API responses. Where they overlap they match the codes
+// of the admin TUI's JSON output.
+const (
+	codeUnauthorized     = "unauthorized"       // Bearer token is missing, unknown or expired
+	codeNotFound         = "not_found"          // No endpoint at the path
+	codeMethodNotAllowed = "method_not_allowed" // Endpoint does not support the method
+	codeInvalidArgument  = "invalid_argument"   // Request body or parameter could not be parsed
+	codeRepoNotFound     = "repo_not_found"     // Repository does not exist
+	codeRepoExists       = "repo_exists"        // Repository name is taken
+	codeUserNotFound     = "user_not_found"     // User does not exist
+	codeUserExists       = "user_exists"        // User name is taken
+	codeKeyNotFound      = "key_not_found"      // Key with the fingerprint does not exist
+	codeKeyExists        = "key_exists"         // User already has the key
+	codeKeyInUse         = "key_in_use"         // Key belongs to another user or deploy key
+	codeGuestReserved    = "guest_reserved"     // Guest user cannot be created or deleted
+	codeGuestReadOnly    = "guest_read_only"    // Guest user cannot get write access
+	codeUserHasGrants    = "user_has_grants"    // User still has grants, see ?cascade=true
+	codeSaveFailed       = "save_failed"        // Data could not be written to disk
+	codeFailed           = "failed"             // Operation was refused for another reason
+)
+
+// errorResponse is the body of a failed request
+type errorResponse struct {
+	Error  errorBody   `json:"error"`
+	Grants []dto.Grant `json:"grants,omitempty"` // Grants that prevent deleting a user
+}
+
+// errorBody describes why a request failed
+type errorBody struct {
+	Code    string `json:"code"`    // Stable error code
+	Message string `json:"message"` // Human readable message
+}
+
+// writeError writes an error response
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, errorResponse{Error: errorBody{Code: code, Message: message}})
+}
+
+// writeErr writes the error response for an error of the managers
+func writeErr(w http.ResponseWriter, err error) {
+	status, code := classify(err)
+	writeError(w, status, code, err.Error())
+}
+
+// classify maps errors of the managers to a status and error code. Other
+// errors are validation failures such as an invalid repository name.
+func classify(err error) (int, string) {
+	var repoNotFound *repo.NotFoundError
+	var repoExists *repo.ExistsError
+	var userNotFound *auth.UserNotFoundError
+	var userExists *auth.UserExistsError
+	var nameTaken *auth.NameTakenError
+	switch {
+	case errors.As(err, &repoNotFound):
+		return http.StatusNotFound, codeRepoNotFound
+	case errors.As(err, &repoExists):
+		return http.StatusConflict, codeRepoExists
+	case errors.As(err, &userNotFound):
+		return http.StatusNotFound, codeUserNotFound
+	case errors.As(err, &userExists), errors.As(err, &nameTaken):
+		return http.StatusConflict, codeUserExists
+	case errors.Is(err, auth.ErrKeyNotFound), errors.Is(err, repo.ErrKeyNotFound):
+		return http.StatusNotFound, codeKeyNotFound
+	case errors.Is(err, auth.ErrKeyExists):
+		return http.StatusConflict, codeKeyExists
+	case errors.Is(err, service.ErrKeyInUse):
+		return http.StatusConflict, codeKeyInUse
+	case errors.Is(err, service.ErrUserHasGrants):
+		return http.StatusConflict, codeUserHasGrants
+	case errors.Is(err, service.ErrGuestReserved):
+		return http.StatusBadRequest, codeGuestReserved
+	case errors.Is(err, service.ErrGuestReadOnly):
+		return http.StatusBadRequest, codeGuestReadOnly
+	}
+	return http.StatusUnprocessableEntity, codeFailed
+}
@@ -0,0 +1,327 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/touken928/gitlite/internal/auth"
+	"github.com/touken928/gitlite/internal/dto"
+	"github.com/touken928/gitlite/internal/repo"
+	"github.com/touken928/gitlite/internal/service"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// userDetailJSON describes a single user with keys and grants
+type userDetailJSON struct {
+	Name   string      `json:"name"`
+	Quota  int64       `json:"quota"`
+	Roles  []string    `json:"roles,omitempty"`
+	Keys   []dto.Key   `json:"keys"`
+	Grants []dto.Grant `json:"grants"`
+}
+
+// deletedUserJSON is the response to deleting a user
+type deletedUserJSON struct {
+	Name    string      `json:"name"`
+	Revoked []dto.Grant `json:"revoked"` // Grants revoked with ?cascade=true
+}
+
+// listUsers answers GET /users
+func (s *Server) listUsers(w http.ResponseWriter, r *http.Request) {
+	users := s.authMgr.ListUsers()
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	list := make([]dto.User, 0, len(users))
+	for _, u := range users {
+		list = append(list, dto.ToUser(u))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// createUser answers POST /users
+func (s *Server) createUser(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name string `json:"name"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	if err := s.svc.CreateUser(req.Name); err != nil {
+		writeErr(w, err)
+		return
+	}
+	if s.save(w) {
+		writeJSON(w, http.StatusCreated, s.userDetail(&auth.User{Name: req.Name}))
+	}
+}
+
+// getUser answers GET /users/{user}
+func (s *Server) getUser(w http.ResponseWriter, r *http.Request, name string) {
+	user := s.authMgr.GetUser(name)
+	if user == nil {
+		writeErr(w, &auth.UserNotFoundError{Name: name})
+		return
+	}
+	writeJSON(w, http.StatusOK, s.userDetail(user))
+}
+
+// deleteUser answers DELETE /users/{user}. A user with grants is only
+// deleted with ?cascade=true, which revokes the grants first.
+func (s *Server) deleteUser(w http.ResponseWriter, r *http.Request, name string) {
+	cascade := r.URL.Query().Get("cascade") == "true"
+	grants, err := s.svc.DeleteUser(name, cascade)
+	if errors.Is(err, service.ErrUserHasGrants) {
+		status, code := classify(err)
+		writeJSON(w, status, errorResponse{Error: errorBody{Code: code, Message: err.Error()}, Grants: dto.ToGrants(grants)})
+		return
+	}
+	if err != nil {
+		// The user is deleted before the grants are revoked, keep what was done
+		if s.authMgr.GetUser(name) == nil && !s.save(w) {
+			return
+		}
+		writeErr(w, err)
+		return
+	}
+	if s.save(w) {
+		writeJSON(w, http.StatusOK, deletedUserJSON{Name: name, Revoked: dto.ToGrants(grants)})
+	}
+}
+
+// listUserKeys answers GET /users/{user}/keys
+func (s *Server) listUserKeys(w http.ResponseWriter, r *http.Request, name string) {
+	user := s.authMgr.GetUser(name)
+	if user == nil {
+		writeErr(w, &auth.UserNotFoundError{Name: name})
+		return
+	}
+	writeJSON(w, http.StatusOK, dto.ToKeys(user.Keys))
+}
+
+// addUserKey answers POST /users/{user}/keys. The comment defaults to the
+// one of the authorized_keys line.
+func (s *Server) addUserKey(w http.ResponseWriter, r *http.Request, name string) {
+	var req struct {
+		Key       string     `json:"key"`
+		Comment   string     `json:"comment"`
+		ExpiresAt *time.Time `json:"expires_at"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	pubKey, comment, _, _, err := gossh.ParseAuthorizedKey([]byte(req.Key))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidArgument, "invalid public key: "+err.Error())
+		return
+	}
+	if req.Comment != "" {
+		comment = req.Comment
+	}
+	key := &auth.Key{
+		PublicKey: pubKey,
+		Comment:   comment,
+		AddedAt:   time.Now(),
+		AddedBy:   actor(r),
+	}
+	if req.ExpiresAt != nil {
+		key.ExpiresAt = *req.ExpiresAt
+	}
+	if err := s.svc.AddUserKey(name, key); err != nil {
+		writeErr(w, err)
+		return
+	}
+	if s.save(w) {
+		writeJSON(w, http.StatusCreated, dto.ToKey(key))
+	}
+}
+
+// deleteUserKey answers DELETE /users/{user}/keys/{fingerprint}
+func (s *Server) deleteUserKey(w http.ResponseWriter, r *http.Request, name, fingerprint string) {
+	if err := s.authMgr.RemoveKeyFromUser(name, fingerprint); err != nil {
+		writeErr(w, err)
+		return
+	}
+	if s.save(w) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// listUserGrants answers GET /users/{user}/grants
+func (s *Server) listUserGrants(w http.ResponseWriter, r *http.Request, name string) {
+	if name != service.GuestUser && s.authMgr.GetUser(name) == nil {
+		writeErr(w, &auth.UserNotFoundError{Name: name})
+		return
+	}
+	writeJSON(w, http.StatusOK, dto.ToGrants(s.svc.UserGrants(name)))
+}
+
+// listRepos answers GET /repos
+func (s *Server) listRepos(w http.ResponseWriter, r *http.Request) {
+	repos := s.repoMgr.List()
+	sort.Slice(repos, func(i, j int) bool { return repos[i].Name < repos[j].Name })
+	list := make([]dto.Repo, 0, len(repos))
+	for _, rp := range repos {
+		list = append(list, dto.ToRepo(rp))
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+// createRepo answers POST /repos. Template grants that cannot be applied
+// are skipped and reported as warnings.
+func (s *Server) createRepo(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Name     string `json:"name"`
+		Template string `json:"template"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	skipped, err := s.svc.CreateRepo(req.Name, req.Template)
+	if err != nil {
+		writeErr(w, err)
+		return
+	}
+	if !s.save(w) {
+		return
+	}
+	created := dto.Repo{Name: req.Name}
+	if rp := s.repoMgr.Get(req.Name); rp != nil {
+		created = dto.ToRepo(rp)
+	}
+	for _, err := range skipped {
+		created.Warnings = append(created.Warnings, err.Error())
+	}
+	writeJSON(w, http.StatusCreated, created)
+}
+
+// getRepo answers GET /repos/{repo}
+func (s *Server) getRepo(w http.ResponseWriter, r *http.Request, name string) {
+	rp := s.repoMgr.Get(name)
+	if rp == nil {
+		writeErr(w, &repo.NotFoundError{Name: name})
+		return
+	}
+	writeJSON(w, http.StatusOK, dto.ToRepo(rp))
+}
+
+// deleteRepo answers DELETE /repos/{repo}, which moves the repository to the trash
+func (s *Server) deleteRepo(w http.ResponseWriter, r *http.Request, name string) {
+	if err := s.repoMgr.Delete(name); err != nil {
+		writeErr(w, err)
+		return
+	}
+	if s.save(w) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// listRepoGrants answers GET /repos/{repo}/grants
+func (s *Server) listRepoGrants(w http.ResponseWriter, r *http.Request, name string) {
+	rp := s.repoMgr.Get(name)
+	if rp == nil {
+		writeErr(w, &repo.NotFoundError{Name: name})
+		return
+	}
+	grants := make([]dto.Grant, 0, len(rp.Users))
+	for u, p := range rp.Users {
+		grants = append(grants, dto.Grant{Repo: rp.Name, User: u, Perm: p.String()})
+	}
+	sort.Slice(grants, func(i, j int) bool { return grants[i].User < grants[j].User })
+	writeJSON(w, http.StatusOK, grants)
+}
+
+// putGrant answers PUT /repos/{repo}/grants/{user}, which sets the
+// permission of a user or guest
+func (s *Server) putGrant(w http.ResponseWriter, r *http.Request, repoName, userName string) {
+	var req struct {
+		Perm string `json:"perm"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	perm, ok := repo.ParsePermission(req.Perm)
+	if !ok {
+		writeError(w, http.StatusBadRequest, codeInvalidArgument, `perm must be "r", "rw" or "maintain"`)
+		return
+	}
+	if err := s.svc.GrantUser(repoName, userName, perm); err != nil {
+		writeErr(w, err)
+		return
+	}
+	if s.save(w) {
+		writeJSON(w, http.StatusOK, dto.Grant{Repo: repoName, User: userName, Perm: req.Perm})
+	}
+}
+
+// deleteGrant answers DELETE /repos/{repo}/grants/{user}
+func (s *Server) deleteGrant(w http.ResponseWriter, r *http.Request, repoName, userName string) {
+	if err := s.repoMgr.RemoveUser(repoName, userName); err != nil {
+		writeErr(w, err)
+		return
+	}
+	if s.save(w) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// listDeployKeys answers GET /repos/{repo}/keys
+func (s *Server) listDeployKeys(w http.ResponseWriter, r *http.Request, name string) {
+	rp := s.repoMgr.Get(name)
+	if rp == nil {
+		writeErr(w, &repo.NotFoundError{Name: name})
+		return
+	}
+	writeJSON(w, http.StatusOK, dto.ToDeployKeys(rp.DeployKeys))
+}
+
+// addDeployKey answers POST /repos/{repo}/keys
+func (s *Server) addDeployKey(w http.ResponseWriter, r *http.Request, name string) {
+	var req struct {
+		Key  string `json:"key"`
+		Perm string `json:"perm"`
+	}
+	if !decode(w, r, &req) {
+		return
+	}
+	perm, ok := repo.ParsePermission(req.Perm)
+	if !ok || perm > repo.PermWrite {
+		writeError(w, http.StatusBadRequest, codeInvalidArgument, `perm must be "r" or "rw"`)
+		return
+	}
+	pubKey, _, _, _, err := gossh.ParseAuthorizedKey([]byte(req.Key))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, codeInvalidArgument, "invalid public key: "+err.Error())
+		return
+	}
+	if err := s.svc.AddDeployKey(name, pubKey, perm); err != nil {
+		writeErr(w, err)
+		return
+	}
+	if s.save(w) {
+		writeJSON(w, http.StatusCreated, dto.DeployKey{Fingerprint: gossh.FingerprintSHA256(pubKey), Perm: req.Perm})
+	}
+}
+
+// deleteDeployKey answers DELETE /repos/{repo}/keys/{fingerprint}
+func (s *Server) deleteDeployKey(w http.ResponseWriter, r *http.Request, name, fingerprint string) {
+	if err := s.repoMgr.RemoveDeployKey(name, fingerprint); err != nil {
+		writeErr(w, err)
+		return
+	}
+	if s.save(w) {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// userDetail describes a user with its keys and grants
+func (s *Server) userDetail(user *auth.User) userDetailJSON {
+	return userDetailJSON{
+		Name:   user.Name,
+		Quota:  user.Quota,
+		Roles:  user.Roles,
+		Keys:   dto.ToKeys(user.Keys),
+		Grants: dto.ToGrants(s.svc.UserGrants(user.Name)),
+	}
+}
@@ -0,0 +1,52 @@
+// Package audit records which administrator changed what. Entries are
+// appended as JSON lines to data/audit.log.
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// FileName is the name of the audit log inside the data directory
+const FileName = "audit.log"
+
+// Entry is one line of the audit log
+type Entry struct {
+	Time    time.Time `json:"time"`             // When the command finished
+	Actor   string    `json:"actor"`            // Administrator, or "api:<token name>" for API requests
+	Via     string    `json:"via"`              // "ssh" for admin commands, "http" for API requests
+	Remote  string    `json:"remote,omitempty"` // Remote IP of the client
+	Command string    `json:"command"`          // Admin command line or HTTP method and path
+	OK      bool      `json:"ok"`               // Whether the command succeeded
+}
+
+// mu serializes writes to the audit log
+var mu sync.Mutex
+
+// Record appends an entry to the audit log of a data directory
+func Record(dataPath string, e Entry) error {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to serialize audit entry: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(dataPath, FileName), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %v", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write audit log: %v", err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/touken928/gitlite/internal/storage"
+)
+
+// adminNameRegex restricts administrator names, which also name their history file
+var adminNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9._-]{0,63}$`)
+
+// AddAdmin adds a key to an administrator, creating the administrator if needed
+func (m *Manager) AddAdmin(name string, key *Key) error {
+	if !adminNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid administrator name: %s", name)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	admin, exists := m.admins[name]
+	if !exists {
+		if _, taken := m.users[name]; taken {
+			return &NameTakenError{Name: name}
+		}
+		admin = &User{Name: name, Keys: []*Key{}}
+	}
+	if err := admin.AddKey(key); err != nil {
+		return err
+	}
+	m.admins[name] = admin
+	return nil
+}
+
+// RemoveAdmin removes an administrator unless no other one could log in
+func (m *Manager) RemoveAdmin(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.admins[name]; !exists {
+		return &AdminNotFoundError{Name: name}
+	}
+	if !m.adminLoginRemains(name, "") {
+		return ErrLastAdmin
+	}
+	delete(m.admins, name)
+	return nil
+}
+
+// RemoveAdminKey removes a key of an administrator unless no administrator could log in
+func (m *Manager) RemoveAdminKey(name, fingerprint string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	admin, exists := m.admins[name]
+	if !exists {
+		return &AdminNotFoundError{Name: name}
+	}
+	if admin.FindKey(fingerprint) == nil {
+		return ErrKeyNotFound
+	}
+	if !m.adminLoginRemains(name, fingerprint) {
+		return ErrLastAdmin
+	}
+	admin.RemoveKey(fingerprint)
+	return nil
+}
+
+// adminLoginRemains reports whether an administrator still has a key once
+// the key with fingerprint, or every key if it is empty, of name is gone.
+// The caller must hold the lock.
+func (m *Manager) adminLoginRemains(name, fingerprint string) bool {
+	for _, admin := range m.admins {
+		for _, k := range admin.Keys {
+			if admin.Name != name || (fingerprint != "" && k.Fingerprint() != fingerprint) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// GetAdmin returns a copy of an administrator by name, or nil if not found
+func (m *Manager) GetAdmin(name string) *User {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	if admin, exists := m.admins[name]; exists {
+		return admin.clone()
+	}
+	return nil
+}
+
+// SetAdminLang sets the preferred language of an administrator, empty
+// follows the SSH locale
+func (m *Manager) SetAdminLang(name, lang string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	admin, exists := m.admins[name]
+	if !exists {
+		return &AdminNotFoundError{Name: name}
+	}
+	admin.Lang = lang
+	return nil
+}
+
+// ListAdmins returns copies of all administrators
+func (m *Manager) ListAdmins() []*User {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	admins := make([]*User, 0, len(m.admins))
+	for _, a := range m.admins {
+		admins = append(admins, a.clone())
+	}
+	return admins
+}
+
+// SaveAdminsToFile persists administrators to a JSON file
+func (m *Manager) SaveAdminsToFile(path string) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	admins := make([]storage.Admin, 0, len(m.admins))
+	for _, a := range m.admins {
+		admins = append(admins, storage.Admin{Name: a.Name, Keys: saveKeys(a.Keys), Lang: a.Lang})
+	}
+
+	return storage.SaveAdmins(path, admins)
+}
+
+// LoadAdminsFromFile loads administrators from a JSON file
+func (m *Manager) LoadAdminsFromFile(path string) error {
+	adminData, err := storage.LoadAdmins(path)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, ad := range adminData {
+		m.admins[ad.Name] = &User{Name: ad.Name, Keys: loadKeys(ad.Keys), Lang: ad.Lang}
+	}
+
+	return nil
+}
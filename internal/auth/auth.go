@@ -2,7 +2,9 @@ package auth
 
 import (
 	"fmt"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/touken928/gitlite/internal/storage"
 
@@ -17,25 +19,61 @@ type AuthManager interface {
 	CreateUser(name string) error
 	// DeleteUser removes a user by name
 	DeleteUser(name string) error
-	// GetUser returns a user by name, or nil if not found
+	// GetUser returns a copy of a user by name, or nil if not found
 	GetUser(name string) *User
-	// ListUsers returns all users in the system
+	// ListUsers returns copies of all users in the system
 	ListUsers() []*User
 	// AddKeyToUser adds an SSH key to a user
-	AddKeyToUser(userName string, key ssh.PublicKey) error
+	AddKeyToUser(userName string, key *Key) error
 	// RemoveKeyFromUser removes an SSH key from a user by fingerprint
 	RemoveKeyFromUser(userName, fingerprint string) error
+	// SetKeyExpiry sets when a user's key stops being accepted, zero means never
+	SetKeyExpiry(userName, fingerprint string, expiresAt time.Time) error
+	// RecordKeyUse remembers when and from where a user's key was last used
+	RecordKeyUse(userName, fingerprint, remoteIP string)
+	// SetUserQuota sets the total size a user's writable repositories may use
+	SetUserQuota(userName string, quota int64) error
+	// SetUserRoles replaces the roles of a user
+	SetUserRoles(userName string, roles []string) error
+	// SetUserLang sets the preferred language of a user
+	SetUserLang(userName, lang string) error
 	// SaveToFile persists user data to a JSON file
 	SaveToFile(path string) error
 	// LoadFromFile loads user data from a JSON file
 	LoadFromFile(path string) error
+
+	// AddAdmin adds a key to an administrator, creating the administrator if needed
+	AddAdmin(name string, key *Key) error
+	// RemoveAdmin removes an administrator unless no other one could log in
+	RemoveAdmin(name string) error
+	// RemoveAdminKey removes a key of an administrator unless no administrator could log in
+	RemoveAdminKey(name, fingerprint string) error
+	// GetAdmin returns a copy of an administrator by name, or nil if not found
+	GetAdmin(name string) *User
+	// SetAdminLang sets the preferred language of an administrator
+	SetAdminLang(name, lang string) error
+	// ListAdmins returns copies of all administrators
+	ListAdmins() []*User
+	// SaveAdminsToFile persists administrators to a JSON file
+	SaveAdminsToFile(path string) error
+	// LoadAdminsFromFile loads administrators from a JSON file
+	LoadAdminsFromFile(path string) error
+}
+
+// DeployKeyResolver looks up keys that are attached to a single repository
+type DeployKeyResolver interface {
+	// ResolveDeployKey returns the principal name of a deploy key
+	ResolveDeployKey(key ssh.PublicKey) (string, bool)
 }
 
 // Manager handles user authentication and provides thread-safe operations
 type Manager struct {
-	mu       sync.RWMutex
-	adminKey ssh.PublicKey      // SSH public key for admin authentication
-	users    map[string]*User   // Map of username to User struct
+	mu          sync.RWMutex
+	admins      map[string]*User  // Map of administrator name to their keys
+	users       map[string]*User  // Map of username to User struct
+	deployKeys  DeployKeyResolver // Resolver for repository scoped deploy keys
+	userCAs     []ssh.PublicKey   // CA keys trusted to sign user certificates
+	revokedPath string            // File listing revoked certificates
 }
 
 var _ AuthManager = (*Manager)(nil)
@@ -43,15 +81,16 @@ var _ AuthManager = (*Manager)(nil)
 // NewManager creates a new Manager instance
 func NewManager() *Manager {
 	return &Manager{
-		users: make(map[string]*User),
+		admins: make(map[string]*User),
+		users:  make(map[string]*User),
 	}
 }
 
-// SetAdminKey sets the administrator's SSH public key
-func (m *Manager) SetAdminKey(key ssh.PublicKey) {
+// SetDeployKeyResolver sets the resolver used to authenticate deploy keys
+func (m *Manager) SetDeployKeyResolver(r DeployKeyResolver) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
-	m.adminKey = key
+	m.deployKeys = r
 }
 
 // Authenticate validates an SSH public key and returns the corresponding user and type
@@ -59,15 +98,28 @@ func (m *Manager) Authenticate(key ssh.PublicKey) (*User, UserType) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	// Check if the key matches the admin key
-	if m.adminKey != nil && ssh.FingerprintSHA256(key) == ssh.FingerprintSHA256(m.adminKey) {
-		return &User{Name: "admin"}, UserTypeAdmin
+	// Check if the key belongs to an administrator
+	fingerprint := ssh.FingerprintSHA256(key)
+	for _, admin := range m.admins {
+		if admin.FindKey(fingerprint) != nil {
+			return &User{Name: admin.Name}, UserTypeAdmin
+		}
 	}
 
 	// Check if the key belongs to any registered user
 	for _, user := range m.users {
-		if user.HasKey(key) {
-			return user, UserTypeNormal
+		if k := user.FindKey(fingerprint); k != nil {
+			if k.Expired(time.Now()) {
+				return nil, UserTypeUnknown
+			}
+			return user.clone(), UserTypeNormal
+		}
+	}
+
+	// Check if the key is a deploy key of a repository
+	if m.deployKeys != nil {
+		if principal, ok := m.deployKeys.ResolveDeployKey(key); ok {
+			return &User{Name: principal}, UserTypeDeploy
 		}
 	}
 
@@ -82,11 +134,17 @@ func (m *Manager) CreateUser(name string) error {
 	if name == "admin" {
 		return fmt.Errorf("cannot create user named 'admin'")
 	}
+	if strings.Contains(name, ":") {
+		return fmt.Errorf("user name cannot contain ':'")
+	}
 	if _, exists := m.users[name]; exists {
-		return fmt.Errorf("user %s already exists", name)
+		return &UserExistsError{Name: name}
+	}
+	if _, exists := m.admins[name]; exists {
+		return &NameTakenError{Name: name, Admin: true}
 	}
 
-	m.users[name] = &User{Name: name, Keys: []ssh.PublicKey{}}
+	m.users[name] = &User{Name: name, Keys: []*Key{}}
 	return nil
 }
 
@@ -96,39 +154,42 @@ func (m *Manager) DeleteUser(name string) error {
 	defer m.mu.Unlock()
 
 	if _, exists := m.users[name]; !exists {
-		return fmt.Errorf("user %s does not exist", name)
+		return &UserNotFoundError{Name: name}
 	}
 	delete(m.users, name)
 	return nil
 }
 
-// GetUser returns a user by name, or nil if not found
+// GetUser returns a copy of a user by name, or nil if not found
 func (m *Manager) GetUser(name string) *User {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	return m.users[name]
+	if user, exists := m.users[name]; exists {
+		return user.clone()
+	}
+	return nil
 }
 
-// ListUsers returns all users in the system
+// ListUsers returns copies of all users in the system
 func (m *Manager) ListUsers() []*User {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	users := make([]*User, 0, len(m.users))
 	for _, u := range m.users {
-		users = append(users, u)
+		users = append(users, u.clone())
 	}
 	return users
 }
 
 // AddKeyToUser adds an SSH public key to a user
-func (m *Manager) AddKeyToUser(userName string, key ssh.PublicKey) error {
+func (m *Manager) AddKeyToUser(userName string, key *Key) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	user, exists := m.users[userName]
 	if !exists {
-		return fmt.Errorf("user %s does not exist", userName)
+		return &UserNotFoundError{Name: userName}
 	}
 	return user.AddKey(key)
 }
@@ -140,11 +201,86 @@ func (m *Manager) RemoveKeyFromUser(userName, fingerprint string) error {
 
 	user, exists := m.users[userName]
 	if !exists {
-		return fmt.Errorf("user %s does not exist", userName)
+		return &UserNotFoundError{Name: userName}
 	}
 	if !user.RemoveKey(fingerprint) {
-		return fmt.Errorf("key not found")
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+// SetKeyExpiry sets when a user's key stops being accepted, zero means never
+func (m *Manager) SetKeyExpiry(userName, fingerprint string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, exists := m.users[userName]
+	if !exists {
+		return &UserNotFoundError{Name: userName}
+	}
+	key := user.FindKey(fingerprint)
+	if key == nil {
+		return ErrKeyNotFound
+	}
+	key.ExpiresAt = expiresAt
+	return nil
+}
+
+// RecordKeyUse remembers when and from where a user's key was last used
+func (m *Manager) RecordKeyUse(userName, fingerprint, remoteIP string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, exists := m.users[userName]; exists {
+		if key := user.FindKey(fingerprint); key != nil {
+			key.LastUsed = time.Now()
+			key.LastIP = remoteIP
+		}
+	}
+}
+
+// SetUserQuota sets the total size a user's writable repositories may use, 0 removes the limit
+func (m *Manager) SetUserQuota(userName string, quota int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, exists := m.users[userName]
+	if !exists {
+		return &UserNotFoundError{Name: userName}
+	}
+	user.Quota = quota
+	return nil
+}
+
+// SetUserRoles replaces the roles of a user, an empty list leaves git access only
+func (m *Manager) SetUserRoles(userName string, roles []string) error {
+	for _, role := range roles {
+		if role != RoleAdmin {
+			return fmt.Errorf("unknown role %s", role)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, exists := m.users[userName]
+	if !exists {
+		return &UserNotFoundError{Name: userName}
+	}
+	user.Roles = roles
+	return nil
+}
+
+// SetUserLang sets the preferred language of a user, empty follows the SSH locale
+func (m *Manager) SetUserLang(userName, lang string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, exists := m.users[userName]
+	if !exists {
+		return &UserNotFoundError{Name: userName}
 	}
+	user.Lang = lang
 	return nil
 }
 
@@ -156,8 +292,11 @@ func (m *Manager) SaveToFile(path string) error {
 	users := make([]storage.User, 0, len(m.users))
 	for _, u := range m.users {
 		users = append(users, storage.User{
-			Name: u.Name,
-			Keys: storage.SaveSSHKeys(u.Keys),
+			Name:  u.Name,
+			Keys:  saveKeys(u.Keys),
+			Quota: u.Quota,
+			Roles: u.Roles,
+			Lang:  u.Lang,
 		})
 	}
 
@@ -179,11 +318,55 @@ func (m *Manager) LoadFromFile(path string) error {
 
 	for _, ud := range userData {
 		user := &User{
-			Name: ud.Name,
-			Keys: storage.LoadSSHKeys(ud.Keys),
+			Name:  ud.Name,
+			Keys:  loadKeys(ud.Keys),
+			Quota: ud.Quota,
+			Roles: ud.Roles,
+			Lang:  ud.Lang,
 		}
 		m.users[ud.Name] = user
 	}
 
 	return nil
 }
+
+// saveKeys converts user keys to their persisted form
+func saveKeys(keys []*Key) []storage.Key {
+	out := make([]storage.Key, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, storage.Key{
+			Key:       strings.TrimSpace(string(ssh.MarshalAuthorizedKey(k.PublicKey))),
+			Comment:   k.Comment,
+			AddedAt:   storage.TimePtr(k.AddedAt),
+			AddedBy:   k.AddedBy,
+			LastUsed:  storage.TimePtr(k.LastUsed),
+			LastIP:    k.LastIP,
+			ExpiresAt: storage.TimePtr(k.ExpiresAt),
+		})
+	}
+	return out
+}
+
+// loadKeys converts persisted keys, skipping entries that fail to parse
+func loadKeys(keys []storage.Key) []*Key {
+	out := make([]*Key, 0, len(keys))
+	for _, k := range keys {
+		pubKey, comment, _, _, err := ssh.ParseAuthorizedKey([]byte(k.Key))
+		if err != nil {
+			continue // Skip invalid keys
+		}
+		if k.Comment != "" {
+			comment = k.Comment
+		}
+		out = append(out, &Key{
+			PublicKey: pubKey,
+			Comment:   comment,
+			AddedAt:   storage.TimeValue(k.AddedAt),
+			AddedBy:   k.AddedBy,
+			LastUsed:  storage.TimeValue(k.LastUsed),
+			LastIP:    k.LastIP,
+			ExpiresAt: storage.TimeValue(k.ExpiresAt),
+		})
+	}
+	return out
+}
@@ -0,0 +1,146 @@
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// sourceAddressOption is the certificate critical option restricting client addresses
+const sourceAddressOption = "source-address"
+
+// SetUserCAKeys sets the CA public keys trusted to sign user certificates
+func (m *Manager) SetUserCAKeys(keys []ssh.PublicKey) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.userCAs = keys
+}
+
+// SetRevocationFile sets the file listing revoked certificates.
+// It is read on every certificate login so revocations apply immediately.
+func (m *Manager) SetRevocationFile(path string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.revokedPath = path
+}
+
+// AuthenticateCertificate validates an OpenSSH user certificate against the
+// trusted CAs and maps its first principal naming a registered user to that user
+func (m *Manager) AuthenticateCertificate(cert *ssh.Certificate, remoteAddr net.Addr) (*User, UserType, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if len(m.userCAs) == 0 {
+		return nil, UserTypeUnknown, fmt.Errorf("no trusted user CA configured")
+	}
+	if cert.CertType != ssh.UserCert {
+		return nil, UserTypeUnknown, fmt.Errorf("not a user certificate")
+	}
+	if !m.isUserAuthority(cert.SignatureKey) {
+		return nil, UserTypeUnknown, fmt.Errorf("certificate signed by untrusted CA")
+	}
+	if len(cert.ValidPrincipals) == 0 {
+		return nil, UserTypeUnknown, fmt.Errorf("certificate has no principals")
+	}
+
+	// CheckCert verifies the signature, validity window, revocation and
+	// critical options; source-address is left to the caller
+	checker := &ssh.CertChecker{IsRevoked: m.isRevoked}
+	for _, principal := range cert.ValidPrincipals {
+		user, exists := m.users[principal]
+		if !exists {
+			continue
+		}
+		if err := checker.CheckCert(principal, cert); err != nil {
+			return nil, UserTypeUnknown, err
+		}
+		if err := checkSourceAddress(cert, remoteAddr); err != nil {
+			return nil, UserTypeUnknown, err
+		}
+		return user, UserTypeNormal, nil
+	}
+
+	return nil, UserTypeUnknown, fmt.Errorf("no certificate principal matches a user")
+}
+
+// isUserAuthority reports whether key is a trusted user CA. Callers hold m.mu.
+func (m *Manager) isUserAuthority(key ssh.PublicKey) bool {
+	fingerprint := ssh.FingerprintSHA256(key)
+	for _, ca := range m.userCAs {
+		if ssh.FingerprintSHA256(ca) == fingerprint {
+			return true
+		}
+	}
+	return false
+}
+
+// isRevoked checks a certificate against the revocation file. Each line holds
+// "serial:<n>", "id:<key id>" or the fingerprint of a revoked key; lines
+// starting with # are comments. Callers hold m.mu.
+func (m *Manager) isRevoked(cert *ssh.Certificate) bool {
+	if m.revokedPath == "" {
+		return false
+	}
+	f, err := os.Open(m.revokedPath)
+	if err != nil {
+		// A missing file means nothing is revoked, any other error fails closed
+		return !os.IsNotExist(err)
+	}
+	defer f.Close()
+
+	fingerprint := ssh.FingerprintSHA256(cert.Key)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if serial, ok := strings.CutPrefix(line, "serial:"); ok {
+			if n, err := strconv.ParseUint(serial, 10, 64); err == nil && n == cert.Serial {
+				return true
+			}
+		} else if id, ok := strings.CutPrefix(line, "id:"); ok {
+			if id == cert.KeyId {
+				return true
+			}
+		} else if line == fingerprint {
+			return true
+		}
+	}
+	return scanner.Err() != nil
+}
+
+// checkSourceAddress enforces the source-address critical option
+func checkSourceAddress(cert *ssh.Certificate, remoteAddr net.Addr) error {
+	allowed, ok := cert.CriticalOptions[sourceAddressOption]
+	if !ok {
+		return nil
+	}
+	tcpAddr, ok := remoteAddr.(*net.TCPAddr)
+	if !ok {
+		return fmt.Errorf("cannot check source address of %v", remoteAddr)
+	}
+
+	for _, entry := range strings.Split(allowed, ",") {
+		entry = strings.TrimSpace(entry)
+		if ip := net.ParseIP(entry); ip != nil {
+			if ip.Equal(tcpAddr.IP) {
+				return nil
+			}
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(entry)
+		if err != nil {
+			return fmt.Errorf("invalid source-address %q in certificate", entry)
+		}
+		if ipNet.Contains(tcpAddr.IP) {
+			return nil
+		}
+	}
+	return fmt.Errorf("source address %s not allowed by certificate", tcpAddr.IP)
+}
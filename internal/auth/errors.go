@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Errors returned for key operations
+var (
+	ErrKeyNotFound = errors.New("key not found")      // User has no key with the fingerprint
+	ErrKeyExists   = errors.New("key already exists") // User already has the key
+)
+
+// ErrTokenNotFound is returned when revoking an API token that does not exist
+var ErrTokenNotFound = errors.New("token not found")
+
+// UserNotFoundError is returned for operations on a user that does not exist
+type UserNotFoundError struct {
+	Name string // User name
+}
+
+// Error implements error
+func (e *UserNotFoundError) Error() string {
+	return fmt.Sprintf("user %s does not exist", e.Name)
+}
+
+// UserExistsError is returned when a user name is already taken
+type UserExistsError struct {
+	Name string // User name
+}
+
+// Error implements error
+func (e *UserExistsError) Error() string {
+	return fmt.Sprintf("user %s already exists", e.Name)
+}
+
+// NameTakenError is returned when an administrator and a user would share
+// a name, and with it the audit actor and the command history
+type NameTakenError struct {
+	Name  string // Name in question
+	Admin bool   // Whether an administrator holds the name, otherwise a user
+}
+
+// Error implements error
+func (e *NameTakenError) Error() string {
+	if e.Admin {
+		return fmt.Sprintf("%s is already the name of an administrator", e.Name)
+	}
+	return fmt.Sprintf("%s is already the name of a user", e.Name)
+}
+
+// ErrLastAdmin is returned when a change would leave no administrator able to log in
+var ErrLastAdmin = errors.New("cannot remove the last administrator")
+
+// AdminNotFoundError is returned for operations on an administrator that does not exist
+type AdminNotFoundError struct {
+	Name string // Administrator name
+}
+
+// Error implements error
+func (e *AdminNotFoundError) Error() string {
+	return fmt.Sprintf("administrator %s does not exist", e.Name)
+}
@@ -1,7 +1,7 @@
 package auth
 
 import (
-	"fmt"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 )
@@ -13,22 +13,70 @@ const (
 	UserTypeUnknown UserType = iota // Unauthenticated or unknown user
 	UserTypeAdmin                   // Administrator with full access
 	UserTypeNormal                  // Regular authenticated user
+	UserTypeDeploy                  // Deploy key scoped to a single repository
 )
 
 // User represents a user with their associated SSH public keys
 type User struct {
-	Name string             // Unique username
-	Keys []ssh.PublicKey    // SSH public keys for authentication
+	Name  string   // Unique username
+	Keys  []*Key   // SSH public keys for authentication
+	Quota int64    // Total size of writable repositories in bytes, 0 means unlimited
+	Roles []string // Roles beyond git access, such as RoleAdmin
+	Lang  string   // Preferred language, empty follows the SSH locale
 }
 
-// AddKey adds a new SSH public key to the user, returns error if key already exists
-func (u *User) AddKey(key ssh.PublicKey) error {
-	fingerprint := ssh.FingerprintSHA256(key)
-	for _, k := range u.Keys {
-		if ssh.FingerprintSHA256(k) == fingerprint {
-			return fmt.Errorf("key already exists")
+// RoleAdmin lets a user open the admin CLI with their own keys, in
+// addition to using git
+const RoleAdmin = "admin"
+
+// HasRole reports whether the user carries a role
+func (u *User) HasRole(role string) bool {
+	for _, r := range u.Roles {
+		if r == role {
+			return true
 		}
 	}
+	return false
+}
+
+// Key is an SSH public key of a user together with its metadata
+type Key struct {
+	PublicKey ssh.PublicKey // SSH public key
+	Comment   string        // Label, taken from the authorized_keys comment by default
+	AddedAt   time.Time     // When the key was added, zero for keys from older versions
+	AddedBy   string        // Administrator who added the key
+	LastUsed  time.Time     // Last login with this key, zero if never used
+	LastIP    string        // Remote IP of the last login
+	ExpiresAt time.Time     // Key is refused from this time on, zero means never
+}
+
+// Fingerprint returns the SHA256 fingerprint of the key
+func (k *Key) Fingerprint() string {
+	return ssh.FingerprintSHA256(k.PublicKey)
+}
+
+// Expired returns true if the key must no longer be accepted at the given time
+func (k *Key) Expired(now time.Time) bool {
+	return !k.ExpiresAt.IsZero() && !now.Before(k.ExpiresAt)
+}
+
+// clone returns a copy of the user that shares no keys or roles with it
+func (u *User) clone() *User {
+	copied := *u
+	copied.Keys = make([]*Key, len(u.Keys))
+	for i, k := range u.Keys {
+		key := *k
+		copied.Keys[i] = &key
+	}
+	copied.Roles = append([]string(nil), u.Roles...)
+	return &copied
+}
+
+// AddKey adds a new SSH public key to the user, returns error if key already exists
+func (u *User) AddKey(key *Key) error {
+	if u.FindKey(key.Fingerprint()) != nil {
+		return ErrKeyExists
+	}
 	u.Keys = append(u.Keys, key)
 	return nil
 }
@@ -36,7 +84,7 @@ func (u *User) AddKey(key ssh.PublicKey) error {
 // RemoveKey removes an SSH public key by its fingerprint, returns true if found and removed
 func (u *User) RemoveKey(fingerprint string) bool {
 	for i, k := range u.Keys {
-		if ssh.FingerprintSHA256(k) == fingerprint {
+		if k.Fingerprint() == fingerprint {
 			u.Keys = append(u.Keys[:i], u.Keys[i+1:]...)
 			return true
 		}
@@ -44,13 +92,17 @@ func (u *User) RemoveKey(fingerprint string) bool {
 	return false
 }
 
-// HasKey returns true if the user has the given SSH public key
-func (u *User) HasKey(key ssh.PublicKey) bool {
-	fingerprint := ssh.FingerprintSHA256(key)
+// FindKey returns the key with the given fingerprint, or nil if the user does not have it
+func (u *User) FindKey(fingerprint string) *Key {
 	for _, k := range u.Keys {
-		if ssh.FingerprintSHA256(k) == fingerprint {
-			return true
+		if k.Fingerprint() == fingerprint {
+			return k
 		}
 	}
-	return false
+	return nil
+}
+
+// HasKey returns true if the user has the given SSH public key
+func (u *User) HasKey(key ssh.PublicKey) bool {
+	return u.FindKey(ssh.FingerprintSHA256(key)) != nil
 }
@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/touken928/gitlite/internal/storage"
+)
+
+// tokenPrefix starts every API token, so leaked tokens are easy to recognize
+const tokenPrefix = "glt_"
+
+// Token is a bearer token of the HTTP admin API. The secret is only known
+// when the token is issued; afterwards just its hash is kept.
+type Token struct {
+	ID        string    // Public part of the token, used to list and revoke it
+	Name      string    // Label describing what the token is for
+	Hash      string    // Hex encoded SHA-256 of the secret
+	CreatedAt time.Time // When the token was issued
+	CreatedBy string    // Administrator who issued the token
+	LastUsed  time.Time // Last request made with the token, zero if never used
+	ExpiresAt time.Time // Token is refused from this time on, zero means never
+}
+
+// Expired returns true if the token must no longer be accepted at the given time
+func (t *Token) Expired(now time.Time) bool {
+	return !t.ExpiresAt.IsZero() && !now.Before(t.ExpiresAt)
+}
+
+// TokenManager issues and verifies API tokens and provides thread-safe operations
+type TokenManager struct {
+	mu     sync.RWMutex
+	tokens map[string]*Token // Map of token ID to Token struct
+}
+
+// NewTokenManager creates a new TokenManager instance
+func NewTokenManager() *TokenManager {
+	return &TokenManager{
+		tokens: make(map[string]*Token),
+	}
+}
+
+// Issue creates a token and returns it together with its secret, which
+// is shown to the administrator once and never stored
+func (m *TokenManager) Issue(name, createdBy string, expiresAt time.Time) (*Token, string, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, "", fmt.Errorf("token name cannot be empty")
+	}
+
+	id := make([]byte, 8)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return nil, "", fmt.Errorf("failed to generate token: %v", err)
+	}
+
+	token := &Token{
+		ID:        hex.EncodeToString(id),
+		Name:      name,
+		CreatedAt: time.Now(),
+		CreatedBy: createdBy,
+		ExpiresAt: expiresAt,
+	}
+	value := tokenPrefix + token.ID + "_" + base64.RawURLEncoding.EncodeToString(secret)
+	token.Hash = hashToken(value)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tokens[token.ID] = token
+	copied := *token
+	return &copied, value, nil
+}
+
+// Revoke deletes a token by ID
+func (m *TokenManager) Revoke(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.tokens[id]; !exists {
+		return ErrTokenNotFound
+	}
+	delete(m.tokens, id)
+	return nil
+}
+
+// List returns copies of all tokens, oldest first
+func (m *TokenManager) List() []*Token {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tokens := make([]*Token, 0, len(m.tokens))
+	for _, t := range m.tokens {
+		copied := *t
+		tokens = append(tokens, &copied)
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.Before(tokens[j].CreatedAt) })
+	return tokens
+}
+
+// Verify checks a token presented by a client and records its use. It
+// returns a copy of the token, or false if it is unknown or expired.
+func (m *TokenManager) Verify(value string) (*Token, bool) {
+	rest, ok := strings.CutPrefix(value, tokenPrefix)
+	if !ok {
+		return nil, false
+	}
+	id, _, ok := strings.Cut(rest, "_")
+	if !ok {
+		return nil, false
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, exists := m.tokens[id]
+	if !exists || subtle.ConstantTimeCompare([]byte(token.Hash), []byte(hashToken(value))) != 1 {
+		return nil, false
+	}
+	now := time.Now()
+	if token.Expired(now) {
+		return nil, false
+	}
+	token.LastUsed = now
+	copied := *token
+	return &copied, true
+}
+
+// SaveToFile persists tokens to a JSON file
+func (m *TokenManager) SaveToFile(path string) error {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tokens := make([]storage.APIToken, 0, len(m.tokens))
+	for _, t := range m.tokens {
+		tokens = append(tokens, storage.APIToken{
+			ID:        t.ID,
+			Name:      t.Name,
+			Hash:      t.Hash,
+			CreatedAt: t.CreatedAt,
+			CreatedBy: t.CreatedBy,
+			LastUsed:  storage.TimePtr(t.LastUsed),
+			ExpiresAt: storage.TimePtr(t.ExpiresAt),
+		})
+	}
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.Before(tokens[j].CreatedAt) })
+
+	return storage.SaveTokens(path, tokens)
+}
+
+// LoadFromFile loads tokens from a JSON file
+func (m *TokenManager) LoadFromFile(path string) error {
+	tokenData, err := storage.LoadTokens(path)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, td := range tokenData {
+		m.tokens[td.ID] = &Token{
+			ID:        td.ID,
+			Name:      td.Name,
+			Hash:      td.Hash,
+			CreatedAt: td.CreatedAt,
+			CreatedBy: td.CreatedBy,
+			LastUsed:  storage.TimeValue(td.LastUsed),
+			ExpiresAt: storage.TimeValue(td.ExpiresAt),
+		}
+	}
+
+	return nil
+}
+
+// hashToken returns the hex encoded SHA-256 of a token
+func hashToken(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,232 @@
+// Package backup writes and restores archives of the GitLite data directory
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/touken928/gitlite/internal/audit"
+	"github.com/touken928/gitlite/internal/auth"
+	"github.com/touken928/gitlite/internal/repo"
+	"github.com/touken928/gitlite/internal/storage"
+)
+
+// Version is the archive format written by Create
+const Version = 1
+
+// manifestName is the archive entry describing the backup
+const manifestName = "gitlite-backup.json"
+
+// dataFiles lists the files of the data directory that are backed up as is.
+// Missing files are skipped. The audit log is only appended to, so a copy
+// taken while it grows is a complete prefix.
+var dataFiles = []string{"host_key", "admin.pub", "user_ca.pub", "revoked_certs", "tokens.json", "admins.json", audit.FileName}
+
+// dataDirs lists the directories of the data directory that are backed up
+// as is. The trash is left out: its repositories are not in the snapshot,
+// so a restored trash.json would list entries that no longer exist.
+var dataDirs = []string{"templates", "i18n", "history"}
+
+// Manifest describes the content of a backup archive
+type Manifest struct {
+	Version   int       `json:"version"`    // Archive format version
+	CreatedAt time.Time `json:"created_at"` // Time the snapshot was taken
+	Users     int       `json:"users"`      // Number of users
+	Repos     []string  `json:"repos"`      // Names of the backed up repositories
+}
+
+// Create writes a gzipped tar archive of users, permissions, keys,
+// templates and all repositories to w. Writes are only fenced while the
+// repositories are hard linked into a snapshot; the archive is written
+// from the snapshot afterwards. Deleted repositories in the trash are not
+// backed up.
+func Create(w io.Writer, dataPath string, authMgr auth.AuthManager, repoMgr repo.RepoManager) (*Manifest, error) {
+	// The snapshot lives inside the data directory so hard links work
+	snapshot, err := os.MkdirTemp(dataPath, ".snapshot-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snapshot directory: %v", err)
+	}
+	defer os.RemoveAll(snapshot)
+
+	createdAt := time.Now().UTC()
+	// Users are saved inside the fence so their grants match repos.json
+	err = repoMgr.Snapshot(snapshot, func() error {
+		return authMgr.SaveToFile(filepath.Join(snapshot, "users.json"))
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	users, err := storage.LoadUsers(filepath.Join(snapshot, "users.json"))
+	if err != nil {
+		return nil, err
+	}
+	repos, err := storage.LoadRepoPermissions(filepath.Join(snapshot, "repos.json"))
+	if err != nil {
+		return nil, err
+	}
+	manifest := &Manifest{Version: Version, CreatedAt: createdAt, Users: len(users), Repos: make([]string, 0, len(repos))}
+	for _, r := range repos {
+		manifest.Repos = append(manifest.Repos, r.Name)
+	}
+	sort.Strings(manifest.Repos)
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	manifestData, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeEntry(tw, manifestName, manifestData); err != nil {
+		return nil, err
+	}
+	for _, name := range []string{"users.json", "repos.json"} {
+		if err := addFile(tw, filepath.Join(snapshot, name), name); err != nil {
+			return nil, err
+		}
+	}
+	for _, name := range dataFiles {
+		if err := addFile(tw, filepath.Join(dataPath, name), name); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	for _, name := range dataDirs {
+		if err := addTree(tw, filepath.Join(dataPath, name), name); err != nil {
+			return nil, err
+		}
+	}
+	if err := addTree(tw, filepath.Join(snapshot, "repos"), "repos"); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// DefaultPath returns the file a backup taken at t is written to when no
+// path is given
+func DefaultPath(dataPath string, t time.Time) string {
+	return filepath.Join(dataPath, "backups", "gitlite-"+t.Format("20060102-150405")+".tar.gz")
+}
+
+// CreateFile writes a backup to path. The archive is written to a temporary
+// file first, so path never holds a partial backup.
+func CreateFile(path, dataPath string, authMgr auth.AuthManager, repoMgr repo.RepoManager) (*Manifest, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), ".backup-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+
+	manifest, err := Create(f, dataPath, authMgr, repoMgr)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(f.Name(), 0600); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(f.Name(), path); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// writeEntry adds a file with the given content to the archive
+func writeEntry(tw *tar.Writer, name string, data []byte) error {
+	hdr := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     int64(len(data)),
+		ModTime:  time.Now(),
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+// addFile adds a regular file to the archive under name
+func addFile(tw *tar.Writer, path, name string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", path)
+	}
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	// Copy only the size in the header, files such as the audit log may
+	// grow while they are archived
+	_, err = io.CopyN(tw, f, hdr.Size)
+	return err
+}
+
+// addTree adds a directory tree to the archive under prefix. Symlinks and
+// other special files are skipped; a missing directory adds nothing.
+func addTree(tw *tar.Writer, root, prefix string) error {
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(filepath.Join(prefix, rel))
+		if d.IsDir() {
+			info, err := d.Info()
+			if err != nil {
+				return err
+			}
+			hdr, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			hdr.Name = name + "/"
+			return tw.WriteHeader(hdr)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		return addFile(tw, path, name)
+	})
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,227 @@
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	gossh "golang.org/x/crypto/ssh"
+
+	"github.com/touken928/gitlite/internal/repo"
+	"github.com/touken928/gitlite/internal/storage"
+)
+
+// Verify unpacks an archive into a temporary directory and checks it the
+// same way Restore does, without touching the data directory
+func Verify(r io.Reader) (*Manifest, error) {
+	dir, err := os.MkdirTemp("", "gitlite-verify-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+	return unpack(r, dir)
+}
+
+// Restore replaces the data directory with the content of an archive. The
+// archive is unpacked next to the data directory and fully checked first;
+// only then is the current data directory moved aside and returned as
+// previous. It refuses to run while a server uses the data directory,
+// since the server rewrites users.json and repos.json when it stops.
+func Restore(r io.Reader, dataPath string) (manifest *Manifest, previous string, err error) {
+	dataPath, err = filepath.Abs(dataPath)
+	if err != nil {
+		return nil, "", err
+	}
+	if pid := storage.DataDirOwner(dataPath); pid != 0 {
+		return nil, "", fmt.Errorf("server (pid %d) is using %s, stop it before restoring", pid, dataPath)
+	}
+	parent := filepath.Dir(dataPath)
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return nil, "", err
+	}
+	staging, err := os.MkdirTemp(parent, filepath.Base(dataPath)+".restore-")
+	if err != nil {
+		return nil, "", err
+	}
+	defer func() {
+		if err != nil {
+			os.RemoveAll(staging)
+		}
+	}()
+	if err := os.Chmod(staging, 0755); err != nil {
+		return nil, "", err
+	}
+
+	if manifest, err = unpack(r, staging); err != nil {
+		return nil, "", err
+	}
+	if err = relocateRepos(staging, dataPath); err != nil {
+		return nil, "", err
+	}
+
+	if _, statErr := os.Stat(dataPath); statErr == nil {
+		previous = dataPath + ".old-" + time.Now().Format("20060102-150405")
+		if err = os.Rename(dataPath, previous); err != nil {
+			return nil, "", fmt.Errorf("failed to move current data aside: %v", err)
+		}
+	}
+	if err = os.Rename(staging, dataPath); err != nil {
+		if previous != "" {
+			os.Rename(previous, dataPath)
+		}
+		return nil, "", fmt.Errorf("failed to move restored data into place: %v", err)
+	}
+	return manifest, previous, nil
+}
+
+// unpack extracts an archive into dir and validates the result
+func unpack(r io.Reader, dir string) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive: %v", err)
+	}
+	defer gz.Close()
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid archive: %v", err)
+		}
+		if err := extract(tr, hdr, dir); err != nil {
+			return nil, err
+		}
+	}
+	return validate(dir)
+}
+
+// extract writes one archive entry below dir. Only directories and regular
+// files inside the known parts of the data directory are accepted.
+func extract(tr *tar.Reader, hdr *tar.Header, dir string) error {
+	name := path.Clean(hdr.Name)
+	if !allowedEntry(name) {
+		return fmt.Errorf("invalid archive entry: %s", hdr.Name)
+	}
+	target := filepath.Join(dir, filepath.FromSlash(name))
+
+	switch hdr.Typeflag {
+	case tar.TypeDir:
+		return os.MkdirAll(target, 0755)
+	case tar.TypeReg:
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, os.FileMode(hdr.Mode)&0755|0600)
+		if err != nil {
+			return fmt.Errorf("invalid archive entry %s: %v", hdr.Name, err)
+		}
+		if _, err := io.Copy(f, tr); err != nil {
+			f.Close()
+			return fmt.Errorf("invalid archive: %v", err)
+		}
+		return f.Close()
+	default:
+		return fmt.Errorf("invalid archive entry: %s", hdr.Name)
+	}
+}
+
+// allowedEntry reports whether a cleaned archive path belongs to a backup
+func allowedEntry(name string) bool {
+	if name == "." || path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+		return false
+	}
+	switch name {
+	case manifestName, "users.json", "repos.json":
+		return true
+	}
+	for _, f := range dataFiles {
+		if name == f {
+			return true
+		}
+	}
+	top, _, _ := strings.Cut(name, "/")
+	if top == "repos" {
+		return true
+	}
+	for _, d := range dataDirs {
+		if top == d {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks that an unpacked archive is complete and consistent
+func validate(dir string) (*Manifest, error) {
+	data, err := os.ReadFile(filepath.Join(dir, manifestName))
+	if err != nil {
+		return nil, fmt.Errorf("archive has no %s, not a GitLite backup", manifestName)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", manifestName, err)
+	}
+	if manifest.Version != Version {
+		return nil, fmt.Errorf("unsupported backup version %d", manifest.Version)
+	}
+
+	for _, name := range []string{"users.json", "repos.json", "host_key"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return nil, fmt.Errorf("archive has no %s", name)
+		}
+	}
+	if _, err := storage.LoadUsers(filepath.Join(dir, "users.json")); err != nil {
+		return nil, err
+	}
+	keyData, err := os.ReadFile(filepath.Join(dir, "host_key"))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := gossh.ParsePrivateKey(keyData); err != nil {
+		return nil, fmt.Errorf("invalid host key: %v", err)
+	}
+
+	repos, err := storage.LoadRepoPermissions(filepath.Join(dir, "repos.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(repos) != len(manifest.Repos) {
+		return nil, fmt.Errorf("repos.json lists %d repositories, manifest %d", len(repos), len(manifest.Repos))
+	}
+	for _, r := range repos {
+		if err := repo.ValidateName(r.Name); err != nil {
+			return nil, err
+		}
+		repoPath := filepath.Join(dir, "repos", filepath.FromSlash(r.Name)+".git")
+		cmd := exec.Command("git", "--git-dir="+repoPath, "fsck", "--connectivity-only", "--no-dangling", "--no-progress")
+		if out, err := cmd.CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("repository %s is damaged: %v: %s", r.Name, err, strings.TrimSpace(string(out)))
+		}
+	}
+	return &manifest, nil
+}
+
+// relocateRepos points the repository paths in repos.json at their
+// location below dataPath, which may differ from where the backup was taken
+func relocateRepos(dir, dataPath string) error {
+	file := filepath.Join(dir, "repos.json")
+	repos, err := storage.LoadRepoPermissions(file)
+	if err != nil {
+		return err
+	}
+	for i := range repos {
+		repos[i].Path = filepath.Join(dataPath, "repos", filepath.FromSlash(repos[i].Name)+".git")
+	}
+	return storage.SaveRepoPermissions(file, repos)
+}
@@ -2,13 +2,22 @@ package config
 
 import (
 	"os"
+	"runtime"
 	"strconv"
+	"time"
 )
 
 // Config holds application configuration loaded from environment variables
 type Config struct {
-	Port     string // SSH server port
-	DataPath string // Base directory for data storage
+	Port                    string        // SSH server port
+	DataPath                string        // Base directory for data storage
+	TrashRetention          int           // Days deleted repositories stay in the trash, 0 keeps them until purged
+	MaintenanceInterval     time.Duration // Time between scheduled maintenance runs, 0 disables them
+	MaintenanceLooseObjects int           // Loose object count that makes a repository due for gc
+	MaintenanceMaxLoad      float64       // Load average above which scheduled maintenance waits, 0 means no limit
+	HTTPAddr                string        // Listen address of the HTTP admin API, empty disables it
+	HTTPTLSCert             string        // TLS certificate of the HTTP admin API, empty serves plain HTTP
+	HTTPTLSKey              string        // TLS private key of the HTTP admin API
 }
 
 // Get retrieves an environment variable value, returning a default if not set
@@ -29,10 +38,37 @@ func GetInt(key string, defaultValue int) int {
 	return defaultValue
 }
 
+// GetDuration retrieves an environment variable as a duration such as "12h", returning a default if not set or invalid
+func GetDuration(key string, defaultValue time.Duration) time.Duration {
+	if val := os.Getenv(key); val != "" {
+		if d, err := time.ParseDuration(val); err == nil {
+			return d
+		}
+	}
+	return defaultValue
+}
+
+// GetFloat retrieves an environment variable as a float, returning a default if not set or invalid
+func GetFloat(key string, defaultValue float64) float64 {
+	if val := os.Getenv(key); val != "" {
+		if f, err := strconv.ParseFloat(val, 64); err == nil {
+			return f
+		}
+	}
+	return defaultValue
+}
+
 // Load creates a Config instance with values from environment variables
 func Load() *Config {
 	return &Config{
-		Port:     Get("GITLITE_PORT", "2222"),
-		DataPath: Get("GITLITE_DATA", "data"),
+		Port:                    Get("GITLITE_PORT", "2222"),
+		DataPath:                Get("GITLITE_DATA", "data"),
+		TrashRetention:          GetInt("GITLITE_TRASH_RETENTION", 30),
+		MaintenanceInterval:     GetDuration("GITLITE_MAINTENANCE_INTERVAL", 24*time.Hour),
+		MaintenanceLooseObjects: GetInt("GITLITE_MAINTENANCE_LOOSE_OBJECTS", 1000),
+		MaintenanceMaxLoad:      GetFloat("GITLITE_MAINTENANCE_MAX_LOAD", float64(runtime.NumCPU())),
+		HTTPAddr:                Get("GITLITE_HTTP_ADDR", ""),
+		HTTPTLSCert:             Get("GITLITE_HTTP_TLS_CERT", ""),
+		HTTPTLSKey:              Get("GITLITE_HTTP_TLS_KEY", ""),
 	}
 }
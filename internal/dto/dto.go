@@ -0,0 +1,128 @@
+// Package dto holds the JSON form of users, keys, repositories and grants
+// shared by the admin CLI and the HTTP API, so both report them alike
+package dto
+
+import (
+	"time"
+
+	"github.com/touken928/gitlite/internal/auth"
+	"github.com/touken928/gitlite/internal/repo"
+	"github.com/touken928/gitlite/internal/service"
+	"github.com/touken928/gitlite/internal/storage"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// User describes a user in lists
+type User struct {
+	Name  string   `json:"name"`
+	Keys  int      `json:"keys"`
+	Quota int64    `json:"quota"`
+	Roles []string `json:"roles,omitempty"`
+}
+
+// Key describes a user key
+type Key struct {
+	Fingerprint string     `json:"fingerprint"`
+	Type        string     `json:"type"`
+	Comment     string     `json:"comment,omitempty"`
+	AddedAt     *time.Time `json:"added_at,omitempty"`
+	AddedBy     string     `json:"added_by,omitempty"`
+	LastUsed    *time.Time `json:"last_used,omitempty"`
+	LastIP      string     `json:"last_ip,omitempty"`
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	Expired     bool       `json:"expired"`
+}
+
+// Repo describes a repository
+type Repo struct {
+	Name        string            `json:"name"`
+	Description string            `json:"description,omitempty"`
+	Owner       string            `json:"owner,omitempty"`
+	ForkOf      string            `json:"fork_of,omitempty"`
+	Archived    bool              `json:"archived"`
+	Users       map[string]string `json:"users"`
+	Quota       int64             `json:"quota"`
+	MaxBlobSize int64             `json:"max_blob_size"`
+	LastPush    *time.Time        `json:"last_push,omitempty"`
+	Warnings    []string          `json:"warnings,omitempty"` // Template grants skipped on creation
+}
+
+// Grant describes a repository grant
+type Grant struct {
+	Repo string `json:"repo"`
+	User string `json:"user"`
+	Perm string `json:"perm"`
+}
+
+// DeployKey describes a deploy key
+type DeployKey struct {
+	Fingerprint string `json:"fingerprint"`
+	Perm        string `json:"perm"`
+}
+
+// ToUser converts a user for a list
+func ToUser(u *auth.User) User {
+	return User{Name: u.Name, Keys: len(u.Keys), Quota: u.Quota, Roles: u.Roles}
+}
+
+// ToKey converts a user key
+func ToKey(k *auth.Key) Key {
+	return Key{
+		Fingerprint: k.Fingerprint(),
+		Type:        k.PublicKey.Type(),
+		Comment:     k.Comment,
+		AddedAt:     storage.TimePtr(k.AddedAt),
+		AddedBy:     k.AddedBy,
+		LastUsed:    storage.TimePtr(k.LastUsed),
+		LastIP:      k.LastIP,
+		ExpiresAt:   storage.TimePtr(k.ExpiresAt),
+		Expired:     k.Expired(time.Now()),
+	}
+}
+
+// ToKeys converts user keys
+func ToKeys(keys []*auth.Key) []Key {
+	out := make([]Key, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, ToKey(k))
+	}
+	return out
+}
+
+// ToRepo converts a repository
+func ToRepo(r *repo.Repository) Repo {
+	users := make(map[string]string, len(r.Users))
+	for u, p := range r.Users {
+		users[u] = p.String()
+	}
+	return Repo{
+		Name:        r.Name,
+		Description: r.Description,
+		Owner:       r.Owner,
+		ForkOf:      r.ForkOf,
+		Archived:    r.Archived,
+		Users:       users,
+		Quota:       r.Quota,
+		MaxBlobSize: r.MaxBlobSize,
+		LastPush:    storage.TimePtr(r.LastPush),
+	}
+}
+
+// ToGrants converts repository grants
+func ToGrants(grants []service.Grant) []Grant {
+	out := make([]Grant, 0, len(grants))
+	for _, g := range grants {
+		out = append(out, Grant{Repo: g.Repo, User: g.User, Perm: g.Perm.String()})
+	}
+	return out
+}
+
+// ToDeployKeys converts the deploy keys of a repository
+func ToDeployKeys(keys []*repo.DeployKey) []DeployKey {
+	out := make([]DeployKey, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, DeployKey{Fingerprint: gossh.FingerprintSHA256(k.Key), Perm: k.Perm.String()})
+	}
+	return out
+}
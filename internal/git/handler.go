@@ -1,11 +1,18 @@
 package git
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
-	"regexp"
+	"strconv"
 	"strings"
 
+	"github.com/touken928/gitlite/internal/lfs"
+	"github.com/touken928/gitlite/internal/repo"
+
 	"github.com/gliderlabs/ssh"
 )
 
@@ -15,17 +22,22 @@ var (
 	allowedCommands = map[string]bool{
 		"git-upload-pack":  true, // Used for clone, fetch, pull
 		"git-receive-pack": true, // Used for push
+		"git-lfs-transfer": true, // Used for Git LFS object transfer
 	}
-
-	// Regex pattern for validating repository paths
-	repoPathRegex = regexp.MustCompile(`^[a-zA-Z0-9_\-]+(/[a-zA-Z0-9_\-]+)*\.git$`)
 )
 
 // Command represents a parsed git command with its repository path
 type Command struct {
-	Cmd      string // Git command name (git-upload-pack or git-receive-pack)
-	RepoPath string // Repository path (e.g., "myrepo.git")
-	IsWrite  bool   // True if this is a write operation (push)
+	Cmd       string // Git command name (git-upload-pack, git-receive-pack or git-lfs-transfer)
+	RepoPath  string // Repository path (e.g., "myrepo.git")
+	Operation string // LFS operation ("upload" or "download"), empty for other commands
+	IsWrite   bool   // True if this is a write operation (push or LFS upload)
+}
+
+// IsCommand reports whether rawCmd invokes one of the allowed git commands
+func IsCommand(rawCmd string) bool {
+	fields := strings.Fields(rawCmd)
+	return len(fields) > 0 && allowedCommands[fields[0]]
 }
 
 // ParseCommand parses a raw SSH git command string into a Command struct
@@ -40,30 +52,117 @@ func ParseCommand(rawCmd string) (*Command, error) {
 		return nil, fmt.Errorf("command not allowed: %s", cmd)
 	}
 
+	// git-lfs-transfer takes the operation after the repository path
+	repoArg, operation := parts[1], ""
+	if cmd == "git-lfs-transfer" {
+		args := strings.Fields(parts[1])
+		if len(args) != 2 || (args[1] != lfs.OpUpload && args[1] != lfs.OpDownload) {
+			return nil, fmt.Errorf("invalid lfs operation")
+		}
+		repoArg, operation = args[0], args[1]
+	}
+
 	// Extract and normalize repository path
-	repoPath := strings.Trim(parts[1], "'\"")
+	repoPath := strings.Trim(repoArg, "'\"")
 	repoPath = strings.TrimPrefix(repoPath, "/")
 
-	if !repoPathRegex.MatchString(repoPath) {
-		return nil, fmt.Errorf("invalid repo path: %s", repoPath)
+	if _, err := repo.ParsePath(repoPath); err != nil {
+		return nil, err
 	}
 
 	return &Command{
-		Cmd:      cmd,
-		RepoPath: repoPath,
-		IsWrite:  cmd == "git-receive-pack",
+		Cmd:       cmd,
+		RepoPath:  repoPath,
+		Operation: operation,
+		IsWrite:   cmd == "git-receive-pack" || operation == lfs.OpUpload,
 	}, nil
 }
 
+// Limits restricts what a push may add to a repository, zero values mean unlimited
+type Limits struct {
+	MaxInputSize int64 // Largest pack accepted by git-receive-pack in bytes
+	MaxBlobSize  int64 // Largest single blob accepted in bytes, checked by the pre-receive hook
+}
+
+// env returns the environment for git with the limits added to base.
+// Config entries are appended after those already set through
+// GIT_CONFIG_COUNT in base, which keeps them in effect.
+func (l Limits) env(base []string) []string {
+	env := make([]string, 0, len(base)+4)
+	count := 0
+	for _, kv := range base {
+		if v, ok := strings.CutPrefix(kv, "GIT_CONFIG_COUNT="); ok {
+			count, _ = strconv.Atoi(v)
+			continue
+		}
+		env = append(env, kv)
+	}
+	if l.MaxInputSize > 0 {
+		env = append(env,
+			fmt.Sprintf("GIT_CONFIG_KEY_%d=receive.maxInputSize", count),
+			fmt.Sprintf("GIT_CONFIG_VALUE_%d=%d", count, l.MaxInputSize),
+		)
+		count++
+	}
+	if count > 0 {
+		env = append(env, fmt.Sprintf("GIT_CONFIG_COUNT=%d", count))
+	}
+	if l.MaxBlobSize > 0 {
+		env = append(env, fmt.Sprintf("GITLITE_MAX_BLOB_SIZE=%d", l.MaxBlobSize))
+	}
+	return env
+}
+
+// ErrInputTooLarge is returned by Execute when git rejected a pack larger
+// than Limits.MaxInputSize. git itself exits successfully in that case.
+var ErrInputTooLarge = errors.New("pack exceeds the push size limit")
+
+// inputLimitMessage is what git prints when a pack exceeds receive.maxInputSize
+const inputLimitMessage = "pack exceeds maximum allowed size"
+
 // Execute runs a git command for the given repository
-func Execute(sess ssh.Session, gitCmd *Command, repoFullPath string) error {
+func Execute(sess ssh.Session, gitCmd *Command, repoFullPath string, limits Limits) error {
 	cmd := exec.Command(gitCmd.Cmd, repoFullPath)
+	cmd.Env = limits.env(os.Environ())
 	cmd.Stdin = sess
 	cmd.Stdout = sess
 	cmd.Stderr = sess.Stderr()
 
+	// The message reaches the client on stdout through the sideband, or on
+	// stderr when the client does not support it
+	var stdout, stderr *matchWriter
+	if limits.MaxInputSize > 0 {
+		stdout = &matchWriter{w: cmd.Stdout, match: []byte(inputLimitMessage)}
+		stderr = &matchWriter{w: cmd.Stderr, match: []byte(inputLimitMessage)}
+		cmd.Stdout, cmd.Stderr = stdout, stderr
+	}
+
 	if err := cmd.Run(); err != nil {
 		return fmt.Errorf("git command failed: %v", err)
 	}
+	if stdout != nil && (stdout.found || stderr.found) {
+		return ErrInputTooLarge
+	}
 	return nil
 }
+
+// matchWriter passes writes on to w and records whether match occurred in
+// them, also when it is split across writes
+type matchWriter struct {
+	w     io.Writer
+	match []byte
+	tail  []byte // End of the previous writes, shorter than match
+	found bool
+}
+
+func (m *matchWriter) Write(p []byte) (int, error) {
+	if !m.found {
+		buf := append(m.tail, p...)
+		m.found = bytes.Contains(buf, m.match)
+		if keep := len(m.match) - 1; len(buf) > keep {
+			buf = buf[len(buf)-keep:]
+		}
+		m.tail = append(m.tail[:0], buf...)
+	}
+	return m.w.Write(p)
+}
@@ -0,0 +1,277 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// builtinCatalogs holds the default catalogs, one <lang>.json per language
+//
+//go:embed catalogs/*.json
+var builtinCatalogs embed.FS
+
+var (
+	mu       sync.RWMutex        // Guards catalogs
+	catalogs map[string]Messages // Message sets by language code
+)
+
+// langCodeRegex matches the language codes catalog files are named after
+var langCodeRegex = regexp.MustCompile(`^[a-z]{2,3}$`)
+
+// verbRegex matches a formatting verb with its optional argument index
+var verbRegex = regexp.MustCompile(`%(?:\[(\d+)\])?[-+# 0]*(?:\d+|\*)?(?:\.(?:\d+|\*)?)?([a-zA-Z%])`)
+
+// catalog is the content of one catalog file
+type catalog struct {
+	source  string                     // File the catalog was read from
+	entries map[string]json.RawMessage // Message by name
+}
+
+func init() {
+	if errs := LoadCatalogs(""); len(errs) > 0 {
+		panic(fmt.Sprintf("invalid built-in message catalogs: %v", errs))
+	}
+}
+
+// GetMessages returns the message set for the specified language, defaulting to English
+func GetMessages(lang string) Messages {
+	mu.RLock()
+	defer mu.RUnlock()
+	if m, ok := catalogs[lang]; ok {
+		return m
+	}
+	return catalogs[DefaultLang]
+}
+
+// Supported reports whether there is a catalog for a language code
+func Supported(lang string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	_, ok := catalogs[lang]
+	return ok
+}
+
+// Languages returns the codes of all languages with a catalog, sorted
+func Languages() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	langs := make([]string, 0, len(catalogs))
+	for lang := range catalogs {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+// LoadCatalogs builds the message sets from the built-in catalogs and the
+// <lang>.json files in dir, which replace single messages or add languages.
+// Messages a language does not define fall back to English. Entries that
+// are invalid, such as unknown names or placeholders that differ from the
+// message they replace, are skipped and reported; the rest still apply.
+// An empty dir loads the built-in catalogs only.
+func LoadCatalogs(dir string) []error {
+	layers, errs := readCatalogs(dir)
+
+	// English is complete and the fallback of every other language
+	base := Messages{}
+	errs = append(errs, apply(&base, DefaultLang, layers[DefaultLang])...)
+	v := reflect.ValueOf(base)
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).IsZero() {
+			errs = append(errs, fmt.Errorf("%s: missing message %s", DefaultLang, v.Type().Field(i).Name))
+		}
+	}
+
+	built := map[string]Messages{DefaultLang: base}
+	for lang, cs := range layers {
+		if lang == DefaultLang {
+			continue
+		}
+		m := base
+		errs = append(errs, apply(&m, lang, cs)...)
+		built[lang] = m
+	}
+
+	mu.Lock()
+	catalogs = built
+	mu.Unlock()
+	return errs
+}
+
+// readCatalogs reads the built-in catalogs followed by those in dir,
+// grouped by language
+func readCatalogs(dir string) (map[string][]catalog, []error) {
+	var errs []error
+	layers := make(map[string][]catalog)
+	add := func(source, name string, data []byte) {
+		lang := strings.TrimSuffix(name, ".json")
+		if !langCodeRegex.MatchString(lang) {
+			errs = append(errs, fmt.Errorf("%s: file name is not a language code", source))
+			return
+		}
+		var entries map[string]json.RawMessage
+		if err := json.Unmarshal(data, &entries); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", source, err))
+			return
+		}
+		layers[lang] = append(layers[lang], catalog{source: source, entries: entries})
+	}
+
+	names, _ := builtinCatalogs.ReadDir("catalogs")
+	for _, entry := range names {
+		data, err := builtinCatalogs.ReadFile(path.Join("catalogs", entry.Name()))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		add("built-in "+entry.Name(), entry.Name(), data)
+	}
+
+	if dir == "" {
+		return layers, errs
+	}
+	files, err := os.ReadDir(dir)
+	if err != nil && !os.IsNotExist(err) {
+		errs = append(errs, fmt.Errorf("failed to read catalogs: %v", err))
+	}
+	for _, entry := range files {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+		file := filepath.Join(dir, entry.Name())
+		data, err := os.ReadFile(file)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", file, err))
+			continue
+		}
+		add(file, entry.Name(), data)
+	}
+	return layers, errs
+}
+
+// apply sets the messages of a language from its catalogs, in order. A
+// message that is already set, from English or an earlier catalog, can only
+// be replaced by one with the same placeholders.
+func apply(m *Messages, lang string, cs []catalog) []error {
+	var errs []error
+	v := reflect.ValueOf(m).Elem()
+	for _, c := range cs {
+		keys := make([]string, 0, len(c.entries))
+		for key := range c.entries {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			field := v.FieldByName(key)
+			if !field.IsValid() {
+				errs = append(errs, fmt.Errorf("%s: unknown message %s", c.source, key))
+				continue
+			}
+			var err error
+			switch current := field.Interface().(type) {
+			case string:
+				var s string
+				if err = json.Unmarshal(c.entries[key], &s); err != nil {
+					err = fmt.Errorf("must be a string")
+				} else if s == "" {
+					err = fmt.Errorf("must not be empty")
+				} else if current != "" {
+					err = checkPlaceholders(s, current)
+				}
+				if err == nil {
+					field.SetString(s)
+				}
+			case Plural:
+				var p Plural
+				if p, err = decodePlural(c.entries[key], lang); err == nil && current.forms != nil {
+					err = checkPlaceholders(p.forms["other"], current.forms["other"])
+				}
+				if err == nil {
+					field.Set(reflect.ValueOf(p))
+				}
+			}
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %s %v", c.source, key, err))
+			}
+		}
+	}
+	return errs
+}
+
+// decodePlural reads the plural forms of a message. Every form needs the
+// placeholders of the "other" form, which is required.
+func decodePlural(data json.RawMessage, lang string) (Plural, error) {
+	var forms map[string]string
+	if err := json.Unmarshal(data, &forms); err != nil {
+		return Plural{}, fmt.Errorf("must be an object of plural forms")
+	}
+	other, ok := forms["other"]
+	if !ok {
+		return Plural{}, fmt.Errorf("has no \"other\" form")
+	}
+	for category, form := range forms {
+		if !pluralCategories[category] {
+			return Plural{}, fmt.Errorf("has unknown plural form %q", category)
+		}
+		if form == "" {
+			return Plural{}, fmt.Errorf("form %q must not be empty", category)
+		}
+		if err := checkPlaceholders(form, other); err != nil {
+			return Plural{}, fmt.Errorf("form %q: %v", category, err)
+		}
+	}
+	return Plural{rule: pluralRuleFor(lang), forms: forms}, nil
+}
+
+// checkPlaceholders verifies that a message takes the same arguments as the
+// message it replaces, in any order
+func checkPlaceholders(message, want string) error {
+	got, expected := placeholders(message), placeholders(want)
+	if !reflect.DeepEqual(got, expected) {
+		return fmt.Errorf("has placeholders [%s], want [%s]", describeVerbs(got), describeVerbs(expected))
+	}
+	return nil
+}
+
+// placeholders returns the verb used for each argument of a format string,
+// keyed by argument index
+func placeholders(format string) map[int]string {
+	verbs := make(map[int]string)
+	next := 1
+	for _, match := range verbRegex.FindAllStringSubmatch(format, -1) {
+		if match[2] == "%" {
+			continue
+		}
+		if match[1] != "" {
+			next, _ = strconv.Atoi(match[1])
+		}
+		verbs[next] = match[2]
+		next++
+	}
+	return verbs
+}
+
+// describeVerbs renders placeholders as "%[1]s %[2]d"
+func describeVerbs(verbs map[int]string) string {
+	indexes := make([]int, 0, len(verbs))
+	for i := range verbs {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+	parts := make([]string, 0, len(indexes))
+	for _, i := range indexes {
+		parts = append(parts, fmt.Sprintf("%%[%d]%s", i, verbs[i]))
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,142 @@
+package i18n
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestPlaceholders(t *testing.T) {
+	tests := []struct {
+		format string
+		want   map[int]string
+	}{
+		{"no verbs", map[int]string{}},
+		{"100%% done", map[int]string{}},
+		{"%s and %d", map[int]string{1: "s", 2: "d"}},
+		{"%[2]s before %[1]s", map[int]string{1: "s", 2: "s"}},
+		{"%[2]d then %s", map[int]string{2: "d", 3: "s"}},
+		{"%-10s|%5.2f|%x", map[int]string{1: "s", 2: "f", 3: "x"}},
+		{"%*d", map[int]string{1: "d"}},
+	}
+	for _, tt := range tests {
+		if got := placeholders(tt.format); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("placeholders(%q) = %v, want %v", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestCheckPlaceholders(t *testing.T) {
+	tests := []struct {
+		message string
+		want    string
+		ok      bool
+	}{
+		{"Repo %s created", "Repository %s created", true},
+		{"%[2]s for %[1]s", "%s for %s", true},
+		{"%[2]d of %[1]s", "%s has %d", true},
+		{"%[2]s of %[1]d", "%s has %d", false},
+		{"Repo created", "Repository %s created", false},
+		{"Repo %s %s", "Repository %s", false},
+		{"Repo %d", "Repository %s", false},
+		{"100%% done", "done", true},
+	}
+	for _, tt := range tests {
+		if err := checkPlaceholders(tt.message, tt.want); (err == nil) != tt.ok {
+			t.Errorf("checkPlaceholders(%q, %q) = %v, want ok %v", tt.message, tt.want, err, tt.ok)
+		}
+	}
+}
+
+func TestPluralRules(t *testing.T) {
+	tests := []struct {
+		lang string
+		n    int
+		want string
+	}{
+		{"en", 0, "other"},
+		{"en", 1, "one"},
+		{"en", 2, "other"},
+		{"de", 1, "one"},
+		{"zh", 1, "other"},
+		{"ja", 5, "other"},
+		{"fr", 0, "one"},
+		{"fr", 1, "one"},
+		{"fr", 2, "other"},
+		{"ru", 1, "one"},
+		{"ru", 21, "one"},
+		{"ru", 11, "many"},
+		{"ru", 2, "few"},
+		{"ru", 24, "few"},
+		{"ru", 12, "many"},
+		{"ru", 5, "many"},
+		{"uk", 0, "many"},
+	}
+	for _, tt := range tests {
+		if got := pluralRuleFor(tt.lang)(tt.n); got != tt.want {
+			t.Errorf("plural rule of %s for %d = %q, want %q", tt.lang, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestDecodePlural(t *testing.T) {
+	tests := []struct {
+		data string
+		ok   bool
+	}{
+		{`{"one": "%d key", "other": "%d keys"}`, true},
+		{`{"other": "%d 个密钥"}`, true},
+		{`{"one": "one key"}`, false},
+		{`{"one": "%d key", "other": "%d keys", "some": "%d keys"}`, false},
+		{`{"one": "%s key", "other": "%d keys"}`, false},
+		{`{"one": "", "other": "%d keys"}`, false},
+		{`"%d keys"`, false},
+	}
+	for _, tt := range tests {
+		_, err := decodePlural(json.RawMessage(tt.data), "en")
+		if (err == nil) != tt.ok {
+			t.Errorf("decodePlural(%s) = %v, want ok %v", tt.data, err, tt.ok)
+		}
+	}
+
+	p, err := decodePlural(json.RawMessage(`{"one": "%d key of %s", "other": "%d keys of %s"}`), "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.Format(1, "bob"); got != "1 key of bob" {
+		t.Errorf("Format(1) = %q", got)
+	}
+	if got := p.Format(3, "bob"); got != "3 keys of bob" {
+		t.Errorf("Format(3) = %q", got)
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		entries string
+		ok      bool
+	}{
+		{`{"LangUsage": "Use: lang <code>"}`, true},
+		{`{"LangUsage": ""}`, false},
+		{`{"LangUsage": 42}`, false},
+		{`{"NoSuchMessage": "text"}`, false},
+		{`{"KeyCount": {"other": "%d keys"}}`, true},
+		{`{"KeyCount": {"other": "keys"}}`, false},
+	}
+	for _, tt := range tests {
+		var entries map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(tt.entries), &entries); err != nil {
+			t.Fatal(err)
+		}
+		m := GetMessages(DefaultLang)
+		before := m
+		errs := apply(&m, DefaultLang, []catalog{{source: "test", entries: entries}})
+		if (len(errs) == 0) != tt.ok {
+			t.Errorf("apply(%s) = %v, want ok %v", tt.entries, errs, tt.ok)
+		}
+		changed := m.LangUsage != before.LangUsage || m.KeyCount.Format(2) != before.KeyCount.Format(2)
+		if !tt.ok && changed {
+			t.Errorf("apply(%s) changed the messages despite the error", tt.entries)
+		}
+	}
+}
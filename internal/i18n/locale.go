@@ -0,0 +1,41 @@
+package i18n
+
+import "strings"
+
+// DefaultLang is used when neither a preference nor the locale names a
+// supported language
+const DefaultLang = "en"
+
+// FromLocale maps a POSIX locale such as "zh_CN.UTF-8" to a supported
+// language code, or returns "" if it names none
+func FromLocale(locale string) string {
+	lang := strings.ToLower(locale)
+	if i := strings.IndexAny(lang, "_.@-"); i >= 0 {
+		lang = lang[:i]
+	}
+	if Supported(lang) {
+		return lang
+	}
+	return ""
+}
+
+// FromEnv picks the language from the LC_ALL, LC_MESSAGES and LANG
+// variables of an environment. As with POSIX locales the first one that is
+// set decides, and locales without translations fall back to DefaultLang.
+func FromEnv(env []string) string {
+	vars := make(map[string]string, len(env))
+	for _, kv := range env {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			vars[k] = v
+		}
+	}
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if locale := vars[name]; locale != "" {
+			if lang := FromLocale(locale); lang != "" {
+				return lang
+			}
+			return DefaultLang
+		}
+	}
+	return DefaultLang
+}
@@ -0,0 +1,76 @@
+package i18n
+
+import "fmt"
+
+// Plural is a message with one form per plural category, such as "one" and
+// "other" in English. Languages without plural forms only have "other".
+type Plural struct {
+	rule  pluralRule        // Rule of the language that picks the form
+	forms map[string]string // Message per plural category
+}
+
+// Format picks the form for n and formats it with n as the first argument,
+// followed by args
+func (p Plural) Format(n int, args ...any) string {
+	form, ok := p.forms[p.rule(n)]
+	if !ok {
+		form = p.forms["other"]
+	}
+	return fmt.Sprintf(form, append([]any{n}, args...)...)
+}
+
+// pluralRule returns the plural category of a count
+type pluralRule func(n int) string
+
+// pluralCategories are the categories a catalog may define, after CLDR
+var pluralCategories = map[string]bool{
+	"zero": true, "one": true, "two": true, "few": true, "many": true, "other": true,
+}
+
+// pluralRules holds the rules of languages that do not pluralize like
+// English. The rules cover integer counts only.
+var pluralRules = map[string]pluralRule{
+	"zh": ruleOther,
+	"ja": ruleOther,
+	"ko": ruleOther,
+	"fr": func(n int) string {
+		if n == 0 || n == 1 {
+			return "one"
+		}
+		return "other"
+	},
+	"ru": ruleSlavic,
+	"uk": ruleSlavic,
+}
+
+// pluralRuleFor returns the plural rule of a language
+func pluralRuleFor(lang string) pluralRule {
+	if rule, ok := pluralRules[lang]; ok {
+		return rule
+	}
+	return ruleEnglish
+}
+
+// ruleEnglish uses "one" for 1 and "other" for everything else
+func ruleEnglish(n int) string {
+	if n == 1 {
+		return "one"
+	}
+	return "other"
+}
+
+// ruleOther is the rule of languages without plural forms
+func ruleOther(int) string {
+	return "other"
+}
+
+// ruleSlavic is the rule of Russian and Ukrainian
+func ruleSlavic(n int) string {
+	switch mod10, mod100 := n%10, n%100; {
+	case mod10 == 1 && mod100 != 11:
+		return "one"
+	case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+		return "few"
+	}
+	return "many"
+}
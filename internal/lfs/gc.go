@@ -0,0 +1,126 @@
+package lfs
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxPointerSize is the largest blob that can be an LFS pointer file
+const maxPointerSize = 1024
+
+// pointerVersion is the first line of every LFS pointer file
+const pointerVersion = "version https://git-lfs.github.com/spec/v1"
+
+// GCGracePeriod is how long an unreferenced object is kept. git-lfs uploads
+// objects before pushing the commits with their pointers, so a new object
+// is not an orphan yet.
+const GCGracePeriod = 24 * time.Hour
+
+// Orphans returns the stored objects of a repository that no LFS pointer in
+// its git object database refers to and that are older than GCGracePeriod.
+// Only lfs/objects is looked at, uploads in progress under lfs/tmp are not.
+func Orphans(repoPath string, now time.Time) ([]Object, error) {
+	objects, err := NewStore(repoPath).List()
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return objects, nil
+	}
+
+	referenced, err := referencedOIDs(repoPath)
+	if err != nil {
+		return nil, err
+	}
+
+	orphans := make([]Object, 0)
+	for _, o := range objects {
+		if !referenced[o.OID] && now.Sub(o.ModTime) >= GCGracePeriod {
+			orphans = append(orphans, o)
+		}
+	}
+	return orphans, nil
+}
+
+// referencedOIDs collects the object IDs of all LFS pointers in a repository
+func referencedOIDs(repoPath string) (map[string]bool, error) {
+	// Find blobs small enough to be pointer files
+	cmd := exec.Command("git", "cat-file", "--batch-all-objects",
+		"--batch-check=%(objectname) %(objecttype) %(objectsize)")
+	cmd.Dir = repoPath
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list objects: %v", err)
+	}
+
+	var candidates bytes.Buffer
+	for _, line := range strings.Split(string(out), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[1] != "blob" {
+			continue
+		}
+		if size, err := strconv.Atoi(fields[2]); err == nil && size < maxPointerSize {
+			candidates.WriteString(fields[0] + "\n")
+		}
+	}
+
+	referenced := make(map[string]bool)
+	if candidates.Len() == 0 {
+		return referenced, nil
+	}
+
+	// Read the candidates and parse the pointers among them
+	cmd = exec.Command("git", "cat-file", "--batch")
+	cmd.Dir = repoPath
+	cmd.Stdin = &candidates
+	out, err = cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read objects: %v", err)
+	}
+
+	r := bufio.NewReader(bytes.NewReader(out))
+	for {
+		header, err := r.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		fields := strings.Fields(header)
+		if len(fields) != 3 {
+			continue
+		}
+		size, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid object header: %q", header)
+		}
+		content := make([]byte, size+1) // Content is followed by a newline
+		if _, err := io.ReadFull(r, content); err != nil {
+			return nil, err
+		}
+		if oid, ok := parsePointer(string(content[:size])); ok {
+			referenced[oid] = true
+		}
+	}
+	return referenced, nil
+}
+
+// parsePointer extracts the object ID from an LFS pointer file
+func parsePointer(content string) (string, bool) {
+	if !strings.HasPrefix(content, pointerVersion+"\n") {
+		return "", false
+	}
+	for _, line := range strings.Split(content, "\n") {
+		if oid, ok := strings.CutPrefix(line, "oid sha256:"); ok && ValidOID(oid) {
+			return oid, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,137 @@
+package lfs
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Packet types besides regular data packets
+const (
+	pktData  = iota // Regular data packet
+	pktFlush        // 0000, ends a message
+	pktDelim        // 0001, separates arguments from data
+)
+
+// maxPktData is the largest payload a single pkt-line can carry
+const maxPktData = 65516
+
+// pktReader reads pkt-line framed messages
+type pktReader struct {
+	r   io.Reader
+	buf []byte
+}
+
+// newPktReader creates a pkt-line reader on top of r
+func newPktReader(r io.Reader) *pktReader {
+	return &pktReader{r: r, buf: make([]byte, maxPktData+4)}
+}
+
+// readPacket reads one packet and returns its type and payload.
+// The payload is only valid until the next call.
+func (p *pktReader) readPacket() (int, []byte, error) {
+	if _, err := io.ReadFull(p.r, p.buf[:4]); err != nil {
+		return 0, nil, err
+	}
+	n, err := strconv.ParseUint(string(p.buf[:4]), 16, 16)
+	if err != nil {
+		return 0, nil, fmt.Errorf("invalid pkt-line length: %q", p.buf[:4])
+	}
+	switch {
+	case n == 0:
+		return pktFlush, nil, nil
+	case n == 1:
+		return pktDelim, nil, nil
+	case n < 4 || n > maxPktData+4:
+		return 0, nil, fmt.Errorf("invalid pkt-line length: %d", n)
+	}
+	data := p.buf[:n-4]
+	if _, err := io.ReadFull(p.r, data); err != nil {
+		return 0, nil, err
+	}
+	return pktData, data, nil
+}
+
+// readText reads text lines until a delimiter or flush packet.
+// It reports whether the section was ended by a delimiter.
+func (p *pktReader) readText() ([]string, bool, error) {
+	var lines []string
+	for {
+		typ, data, err := p.readPacket()
+		if err != nil {
+			return nil, false, err
+		}
+		switch typ {
+		case pktFlush:
+			return lines, false, nil
+		case pktDelim:
+			return lines, true, nil
+		}
+		lines = append(lines, strings.TrimSuffix(string(data), "\n"))
+	}
+}
+
+// dataReader streams the payload of data packets until a flush packet
+type dataReader struct {
+	p    *pktReader
+	rest []byte
+	done bool
+}
+
+// Read implements io.Reader
+func (d *dataReader) Read(b []byte) (int, error) {
+	for len(d.rest) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		typ, data, err := d.p.readPacket()
+		if err != nil {
+			return 0, err
+		}
+		if typ != pktData {
+			d.done = true
+			continue
+		}
+		d.rest = data
+	}
+	n := copy(b, d.rest)
+	d.rest = d.rest[n:]
+	return n, nil
+}
+
+// pktWriter writes pkt-line framed messages
+type pktWriter struct {
+	w io.Writer
+}
+
+// writePacket writes a single data packet
+func (p *pktWriter) writePacket(data []byte) error {
+	if _, err := fmt.Fprintf(p.w, "%04x", len(data)+4); err != nil {
+		return err
+	}
+	_, err := p.w.Write(data)
+	return err
+}
+
+// writeText writes each line as its own newline terminated packet
+func (p *pktWriter) writeText(lines ...string) error {
+	for _, line := range lines {
+		if err := p.writePacket([]byte(line + "\n")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush ends the current message
+func (p *pktWriter) flush() error {
+	_, err := io.WriteString(p.w, "0000")
+	return err
+}
+
+// delim separates arguments from data within a message
+func (p *pktWriter) delim() error {
+	_, err := io.WriteString(p.w, "0001")
+	return err
+}
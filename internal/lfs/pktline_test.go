@@ -0,0 +1,59 @@
+package lfs
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPktRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w := &pktWriter{w: &buf}
+	w.writeText("put-object abc", "size=5")
+	w.delim()
+	w.writePacket([]byte("he"))
+	w.writePacket([]byte("llo"))
+	w.flush()
+	w.writeText("quit")
+	w.flush()
+
+	want := "0013put-object abc\n000bsize=5\n0001" + "0006he0007llo0000" + "0009quit\n0000"
+	if buf.String() != want {
+		t.Fatalf("written %q, want %q", buf.String(), want)
+	}
+
+	r := newPktReader(&buf)
+	lines, delim, err := r.readText()
+	if err != nil || !delim || !reflect.DeepEqual(lines, []string{"put-object abc", "size=5"}) {
+		t.Fatalf("readText() = %q, %v, %v", lines, delim, err)
+	}
+	data, err := io.ReadAll(&dataReader{p: r})
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("data = %q, %v", data, err)
+	}
+	lines, delim, err = r.readText()
+	if err != nil || delim || !reflect.DeepEqual(lines, []string{"quit"}) {
+		t.Fatalf("readText() = %q, %v, %v", lines, delim, err)
+	}
+	if _, _, err := r.readText(); err != io.EOF {
+		t.Fatalf("readText() at end = %v, want EOF", err)
+	}
+}
+
+func TestPktReadInvalid(t *testing.T) {
+	tests := []string{
+		"zzzz",
+		"0002",
+		"0003",
+		"fff5" + strings.Repeat("x", 0xfff1),
+		"0009ab",
+		"00",
+	}
+	for _, in := range tests {
+		if _, _, err := newPktReader(strings.NewReader(in)).readPacket(); err == nil {
+			t.Errorf("readPacket(%.8q) succeeded, want error", in)
+		}
+	}
+}
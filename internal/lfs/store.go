@@ -0,0 +1,120 @@
+package lfs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// oidRegex matches a SHA-256 LFS object ID
+var oidRegex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Object describes a stored LFS object
+type Object struct {
+	OID     string    // SHA-256 of the object content
+	Size    int64     // Object size in bytes
+	ModTime time.Time // Time the object was stored
+}
+
+// Store keeps the LFS objects of one repository inside its bare directory
+type Store struct {
+	root string // <repo>.git/lfs
+}
+
+// NewStore creates a Store for the bare repository at repoPath
+func NewStore(repoPath string) *Store {
+	return &Store{root: filepath.Join(repoPath, "lfs")}
+}
+
+// ValidOID reports whether oid is a well formed object ID
+func ValidOID(oid string) bool {
+	return oidRegex.MatchString(oid)
+}
+
+// objectPath returns the path of an object, sharded like git-lfs does locally
+func (s *Store) objectPath(oid string) string {
+	return filepath.Join(s.root, "objects", oid[0:2], oid[2:4], oid)
+}
+
+// Stat returns the size of an object and whether it exists
+func (s *Store) Stat(oid string) (int64, bool) {
+	info, err := os.Stat(s.objectPath(oid))
+	if err != nil {
+		return 0, false
+	}
+	return info.Size(), true
+}
+
+// Open opens an object for reading
+func (s *Store) Open(oid string) (*os.File, error) {
+	return os.Open(s.objectPath(oid))
+}
+
+// Put stores an object read from r, verifying its size and hash before it
+// becomes visible
+func (s *Store) Put(oid string, size int64, r io.Reader) error {
+	tmpDir := filepath.Join(s.root, "tmp")
+	if err := os.MkdirAll(tmpDir, 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(tmpDir, oid+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("size mismatch: expected %d, got %d", size, n)
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != oid {
+		return fmt.Errorf("hash mismatch: got %s", sum)
+	}
+
+	path := s.objectPath(oid)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Remove deletes an object
+func (s *Store) Remove(oid string) error {
+	return os.Remove(s.objectPath(oid))
+}
+
+// List returns all stored objects
+func (s *Store) List() ([]Object, error) {
+	objects := make([]Object, 0)
+	err := filepath.WalkDir(filepath.Join(s.root, "objects"), func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil // No objects stored yet
+			}
+			return err
+		}
+		if !d.Type().IsRegular() || !ValidOID(d.Name()) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, Object{OID: d.Name(), Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	return objects, err
+}
@@ -0,0 +1,255 @@
+package lfs
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Operations a client can request from git-lfs-transfer
+const (
+	OpUpload   = "upload"
+	OpDownload = "download"
+)
+
+// transfer holds the state of one git-lfs-transfer session
+type transfer struct {
+	r         *pktReader
+	w         *pktWriter
+	store     *Store
+	operation string // OpUpload or OpDownload
+	quota     int64  // Bytes the session may still upload, 0 means unlimited
+}
+
+// Serve runs the Git LFS SSH transfer protocol (git-lfs-transfer) for the
+// bare repository at repoPath until the client quits. quota limits the total
+// number of bytes uploaded in this session, 0 means unlimited.
+func Serve(rw io.ReadWriter, repoPath, operation string, quota int64) error {
+	t := &transfer{
+		r:         newPktReader(rw),
+		w:         &pktWriter{w: rw},
+		store:     NewStore(repoPath),
+		operation: operation,
+		quota:     quota,
+	}
+
+	// Capability advertisement and version negotiation
+	if err := t.w.writeText("version=1"); err != nil {
+		return err
+	}
+	if err := t.w.flush(); err != nil {
+		return err
+	}
+	lines, _, err := t.r.readText()
+	if err != nil {
+		return err
+	}
+	if len(lines) == 0 || lines[0] != "version 1" {
+		return t.sendError(400, "unsupported protocol version")
+	}
+	if err := t.sendStatus(); err != nil {
+		return err
+	}
+
+	for {
+		lines, delim, err := t.r.readText()
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if len(lines) == 0 {
+			continue
+		}
+
+		cmd, arg, _ := strings.Cut(lines[0], " ")
+		args := parseArgs(lines[1:])
+		switch cmd {
+		case "batch":
+			err = t.batch(delim)
+		case "get-object":
+			err = t.getObject(arg)
+		case "put-object":
+			err = t.putObject(arg, args, delim)
+		case "verify-object":
+			err = t.verifyObject(arg, args)
+		case "lock", "list-lock", "unlock":
+			err = t.sendError(501, "locking is not supported")
+		case "quit":
+			return t.sendStatus()
+		default:
+			err = t.sendError(400, "unknown command: "+cmd)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// batch reports which of the requested objects need to be transferred
+func (t *transfer) batch(delim bool) error {
+	var requests []string
+	if delim {
+		var err error
+		if requests, _, err = t.r.readText(); err != nil {
+			return err
+		}
+	}
+
+	results := make([]string, 0, len(requests))
+	for _, req := range requests {
+		fields := strings.Fields(req)
+		if len(fields) < 2 || !ValidOID(fields[0]) {
+			return t.sendError(400, "invalid batch request: "+req)
+		}
+		oid, size := fields[0], fields[1]
+
+		action := "noop"
+		stored, exists := t.store.Stat(oid)
+		switch t.operation {
+		case OpUpload:
+			if !exists || strconv.FormatInt(stored, 10) != size {
+				action = "upload"
+			}
+		case OpDownload:
+			if exists {
+				action = "download"
+				size = strconv.FormatInt(stored, 10)
+			}
+		}
+		results = append(results, fmt.Sprintf("%s %s %s", oid, size, action))
+	}
+
+	if err := t.w.writeText("status 200"); err != nil {
+		return err
+	}
+	if err := t.w.delim(); err != nil {
+		return err
+	}
+	if err := t.w.writeText(results...); err != nil {
+		return err
+	}
+	return t.w.flush()
+}
+
+// getObject streams an object to the client
+func (t *transfer) getObject(oid string) error {
+	if !ValidOID(oid) {
+		return t.sendError(400, "invalid object id")
+	}
+	f, err := t.store.Open(oid)
+	if err != nil {
+		return t.sendError(404, "object not found")
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return t.sendError(500, err.Error())
+	}
+
+	if err := t.w.writeText("status 200", fmt.Sprintf("size=%d", info.Size())); err != nil {
+		return err
+	}
+	if err := t.w.delim(); err != nil {
+		return err
+	}
+	buf := make([]byte, maxPktData)
+	for {
+		n, err := f.Read(buf)
+		if n > 0 {
+			if werr := t.w.writePacket(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return t.w.flush()
+}
+
+// putObject receives an object from the client
+func (t *transfer) putObject(oid string, args map[string]string, delim bool) error {
+	// The object data must always be consumed before replying
+	data := &dataReader{p: t.r, done: !delim}
+
+	if t.operation != OpUpload {
+		io.Copy(io.Discard, data)
+		return t.sendError(403, "upload not allowed in a download session")
+	}
+	size, err := strconv.ParseInt(args["size"], 10, 64)
+	if !ValidOID(oid) || err != nil || size < 0 {
+		io.Copy(io.Discard, data)
+		return t.sendError(400, "invalid object id or size")
+	}
+	// An object already stored takes no further space
+	if stored, exists := t.store.Stat(oid); exists && stored == size {
+		io.Copy(io.Discard, data)
+		return t.sendStatus()
+	}
+	if t.quota > 0 && size > t.quota {
+		io.Copy(io.Discard, data)
+		return t.sendError(507, "repository quota exceeded")
+	}
+
+	if err := t.store.Put(oid, size, data); err != nil {
+		io.Copy(io.Discard, data)
+		return t.sendError(400, err.Error())
+	}
+	if t.quota > 0 {
+		t.quota -= size
+	}
+	return t.sendStatus()
+}
+
+// verifyObject confirms that an uploaded object is stored with the expected size
+func (t *transfer) verifyObject(oid string, args map[string]string) error {
+	if !ValidOID(oid) {
+		return t.sendError(400, "invalid object id")
+	}
+	stored, exists := t.store.Stat(oid)
+	if !exists {
+		return t.sendError(404, "object not found")
+	}
+	if args["size"] != strconv.FormatInt(stored, 10) {
+		return t.sendError(409, "size mismatch")
+	}
+	return t.sendStatus()
+}
+
+// sendStatus sends a successful response without payload
+func (t *transfer) sendStatus() error {
+	if err := t.w.writeText("status 200"); err != nil {
+		return err
+	}
+	return t.w.flush()
+}
+
+// sendError sends an error response with a message for the client
+func (t *transfer) sendError(code int, msg string) error {
+	if err := t.w.writeText(fmt.Sprintf("status %d", code)); err != nil {
+		return err
+	}
+	if err := t.w.delim(); err != nil {
+		return err
+	}
+	if err := t.w.writeText(msg); err != nil {
+		return err
+	}
+	return t.w.flush()
+}
+
+// parseArgs parses key=value argument lines
+func parseArgs(lines []string) map[string]string {
+	args := make(map[string]string, len(lines))
+	for _, line := range lines {
+		k, v, _ := strings.Cut(line, "=")
+		args[k] = v
+	}
+	return args
+}
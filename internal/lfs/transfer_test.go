@@ -0,0 +1,185 @@
+package lfs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+// response is one reply of the server
+type response struct {
+	status string // First line, such as "status 200"
+	args   []string
+	body   string // Lines or data after the delimiter
+}
+
+// client builds the messages a git-lfs client sends
+type client struct {
+	buf bytes.Buffer
+	w   *pktWriter
+}
+
+func newClient() *client {
+	c := &client{}
+	c.w = &pktWriter{w: &c.buf}
+	c.w.writeText("version 1")
+	c.w.flush()
+	return c
+}
+
+func (c *client) send(lines ...string) {
+	c.w.writeText(lines...)
+	c.w.flush()
+}
+
+func (c *client) put(oid string, size int, data string) {
+	c.w.writeText("put-object "+oid, fmt.Sprintf("size=%d", size))
+	c.w.delim()
+	c.w.writePacket([]byte(data))
+	c.w.flush()
+}
+
+// serve runs a session on the messages of c, ending it with quit, and
+// returns the responses after the version exchange and before quit
+func serve(t *testing.T, dir, operation string, quota int64, c *client) []response {
+	t.Helper()
+	c.send("quit")
+	var out bytes.Buffer
+	rw := struct {
+		io.Reader
+		io.Writer
+	}{&c.buf, &out}
+	if err := Serve(rw, dir, operation, quota); err != nil {
+		t.Fatalf("Serve() = %v", err)
+	}
+
+	r := newPktReader(&out)
+	var responses []response
+	for {
+		lines, delim, err := r.readText()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp := response{status: lines[0], args: lines[1:]}
+		if delim {
+			body, err := io.ReadAll(&dataReader{p: r})
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.body = string(body)
+		}
+		responses = append(responses, resp)
+	}
+	// Version advertisement, status after negotiation and status of quit
+	if len(responses) < 3 || responses[0].status != "version=1" || responses[len(responses)-1].status != "status 200" {
+		t.Fatalf("unexpected session framing: %+v", responses)
+	}
+	return responses[2 : len(responses)-1]
+}
+
+// object returns the ID of data
+func object(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func statuses(responses []response) []string {
+	s := make([]string, len(responses))
+	for i, r := range responses {
+		s[i] = r.status
+	}
+	return s
+}
+
+func TestTransferUploadQuota(t *testing.T) {
+	dir := t.TempDir()
+	a, b := "aaaaaa", "bbbbbb"
+
+	c := newClient()
+	c.put(object(a), len(a), "xxxxxx") // Hash mismatch, must not use quota
+	c.put(object(a), len(a), a)
+	c.put(object(a), len(a), a) // Already stored, must not use quota again
+	c.put(object(b), len(b), b) // Exceeds the remaining 4 bytes
+	got := statuses(serve(t, dir, OpUpload, 10, c))
+
+	want := []string{"status 400", "status 200", "status 200", "status 507"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("statuses = %v, want %v", got, want)
+	}
+	store := NewStore(dir)
+	if _, ok := store.Stat(object(a)); !ok {
+		t.Error("uploaded object not stored")
+	}
+	if _, ok := store.Stat(object(b)); ok {
+		t.Error("object over quota was stored")
+	}
+}
+
+func TestTransferCommands(t *testing.T) {
+	dir := t.TempDir()
+	data := "hello"
+	oid, missing := object(data), object("missing")
+	if err := NewStore(dir).Put(oid, int64(len(data)), strings.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		operation string
+		send      func(c *client)
+		status    string
+		body      string
+	}{
+		{OpDownload, func(c *client) {
+			c.w.writeText("batch")
+			c.w.delim()
+			c.send(oid+" 5", missing+" 7")
+		}, "status 200", oid + " 5 download\n" + missing + " 7 noop\n"},
+		{OpUpload, func(c *client) {
+			c.w.writeText("batch")
+			c.w.delim()
+			c.send(oid+" 5", missing+" 7")
+		}, "status 200", oid + " 5 noop\n" + missing + " 7 upload\n"},
+		{OpDownload, func(c *client) { c.send("get-object " + oid) }, "status 200", data},
+		{OpDownload, func(c *client) { c.send("get-object " + missing) }, "status 404", "object not found\n"},
+		{OpDownload, func(c *client) { c.send("get-object nothex") }, "status 400", "invalid object id\n"},
+		{OpDownload, func(c *client) { c.put(missing, 7, "missing") }, "status 403", "upload not allowed in a download session\n"},
+		{OpUpload, func(c *client) { c.send("verify-object "+oid, "size=5") }, "status 200", ""},
+		{OpUpload, func(c *client) { c.send("verify-object "+oid, "size=6") }, "status 409", "size mismatch\n"},
+		{OpUpload, func(c *client) { c.send("verify-object "+missing, "size=7") }, "status 404", "object not found\n"},
+		{OpUpload, func(c *client) { c.send("lock", "path=big.bin") }, "status 501", "locking is not supported\n"},
+		{OpDownload, func(c *client) { c.send("list-lock") }, "status 501", "locking is not supported\n"},
+		{OpUpload, func(c *client) { c.send("unlock 1") }, "status 501", "locking is not supported\n"},
+		{OpUpload, func(c *client) { c.send("frobnicate") }, "status 400", "unknown command: frobnicate\n"},
+	}
+	for i, tt := range tests {
+		c := newClient()
+		tt.send(c)
+		got := serve(t, dir, tt.operation, 0, c)
+		if len(got) != 1 || got[0].status != tt.status || got[0].body != tt.body {
+			t.Errorf("case %d: got %+v, want %s with %q", i, got, tt.status, tt.body)
+		}
+	}
+}
+
+func TestTransferVersion(t *testing.T) {
+	c := &client{}
+	c.w = &pktWriter{w: &c.buf}
+	c.send("version 2")
+	var out bytes.Buffer
+	if err := Serve(struct {
+		io.Reader
+		io.Writer
+	}{&c.buf, &out}, t.TempDir(), OpDownload, 0); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "status 400") || !strings.Contains(out.String(), "unsupported protocol version") {
+		t.Errorf("response to version 2 = %q", out.String())
+	}
+}
@@ -0,0 +1,29 @@
+package repo
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrKeyNotFound is returned when removing a deploy key a repository does not have
+var ErrKeyNotFound = errors.New("key not found")
+
+// NotFoundError is returned for operations on a repository that does not exist
+type NotFoundError struct {
+	Name string // Repository name
+}
+
+// Error implements error
+func (e *NotFoundError) Error() string {
+	return fmt.Sprintf("repository %s does not exist", e.Name)
+}
+
+// ExistsError is returned when a repository name is already taken
+type ExistsError struct {
+	Name string // Repository name
+}
+
+// Error implements error
+func (e *ExistsError) Error() string {
+	return fmt.Sprintf("repository %s already exists", e.Name)
+}
@@ -0,0 +1,152 @@
+package repo
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Fork creates dst as a copy of src. Git objects and LFS objects are hard
+// linked where the filesystem allows it, so a fork costs almost no space and
+// stays intact when src is deleted. The fork starts without permissions.
+// The copy is made without holding the lock, dst is reserved meanwhile.
+func (m *Manager) Fork(src, dst string) error {
+	srcPath, dstPath, description, err := m.reserveFork(src, dst)
+	if err != nil {
+		return err
+	}
+
+	err = cloneFork(srcPath, dstPath)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.reserved, dst)
+	if err != nil {
+		os.RemoveAll(dstPath)
+		return err
+	}
+
+	m.dropAlias(dst)
+	m.repos[dst] = &Repository{
+		Name:        dst,
+		Path:        dstPath,
+		Users:       make(map[string]Permission),
+		Description: description,
+		ForkOf:      src,
+	}
+	return nil
+}
+
+// reserveFork checks that src can be forked to dst and reserves dst. It
+// returns the paths of both repositories and the description of src.
+func (m *Manager) reserveFork(src, dst string) (string, string, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	srcRepo, exists := m.repos[src]
+	if !exists {
+		return "", "", "", &NotFoundError{Name: src}
+	}
+	if _, exists := m.repos[dst]; exists {
+		return "", "", "", &ExistsError{Name: dst}
+	}
+	if err := m.checkCaseCollision(dst); err != nil {
+		return "", "", "", err
+	}
+
+	srcPath, err := m.checkPath(srcRepo.Path)
+	if err != nil {
+		return "", "", "", err
+	}
+	dstPath, err := m.resolvePath(dst)
+	if err != nil {
+		return "", "", "", err
+	}
+	if _, err := os.Lstat(dstPath); err == nil {
+		return "", "", "", fmt.Errorf("path %s already exists", dstPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0755); err != nil {
+		return "", "", "", err
+	}
+
+	m.reserved[dst] = true
+	return srcPath, dstPath, srcRepo.Description, nil
+}
+
+// cloneFork copies the repository at srcPath to dstPath with all its refs
+func cloneFork(srcPath, dstPath string) error {
+	// A local clone hard links the object files of the source; --mirror
+	// fetches +refs/*:refs/*, so notes and other refs besides branches and
+	// tags are kept too
+	cmd := exec.Command("git", "clone", "--mirror", "--quiet", "--", srcPath, dstPath)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to clone repository: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return forkSetup(srcPath, dstPath)
+}
+
+// forkSetup detaches a fresh clone from its source and adds the managed hooks and LFS objects
+func forkSetup(srcPath, dstPath string) error {
+	if err := runGit(dstPath, nil, "remote", "remove", "origin"); err != nil {
+		return err
+	}
+	if err := installHooks(dstPath); err != nil {
+		return fmt.Errorf("failed to install hooks: %v", err)
+	}
+	if err := linkTree(filepath.Join(srcPath, "lfs"), filepath.Join(dstPath, "lfs")); err != nil {
+		return fmt.Errorf("failed to copy LFS objects: %v", err)
+	}
+	return nil
+}
+
+// linkTree recreates the regular files below src in dst as hard links,
+// copying them when linking is not possible
+func linkTree(src, dst string) error {
+	err := filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		if d.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if os.Link(path, target) == nil {
+			return nil
+		}
+		return copyFile(path, target)
+	})
+	if os.IsNotExist(err) {
+		return nil // Source has no LFS objects
+	}
+	return err
+}
+
+// copyFile copies a regular file
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,73 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// managedMarker identifies a pre-receive hook written by GitLite
+const managedMarker = "# Managed by GitLite"
+
+// preReceiveHook enforces the blob size limit passed in by the git handler.
+// Repository specific checks can be placed in hooks/pre-receive.local, which
+// is run afterwards with the same input.
+const preReceiveHook = `#!/bin/sh
+# Managed by GitLite, local changes will be overwritten.
+# Put repository specific checks into hooks/pre-receive.local instead.
+input=$(cat)
+
+if [ "${GITLITE_MAX_BLOB_SIZE:-0}" -gt 0 ]; then
+	echo "$input" | while read old new ref; do
+		case "$new" in *[!0]*) ;; *) continue ;; esac
+		case "$old" in
+			*[!0]*) range="$old..$new" ;;
+			*) range="$new --not --all" ;;
+		esac
+		git rev-list --objects $range |
+			git cat-file --batch-check='%(objecttype) %(objectsize) %(objectname) %(rest)' |
+			awk -v max="$GITLITE_MAX_BLOB_SIZE" '
+				$1 == "blob" && $2 > max { printf "  %s %s (%d bytes)\n", $3, $4, $2; bad = 1 }
+				END { exit bad }' >&2 || exit 1
+	done || {
+		echo "push rejected: blobs above exceed the limit of $GITLITE_MAX_BLOB_SIZE bytes for this repository" >&2
+		exit 1
+	}
+fi
+
+if [ -x "$GIT_DIR/hooks/pre-receive.local" ]; then
+	echo "$input" | "$GIT_DIR/hooks/pre-receive.local"
+	exit $?
+fi
+`
+
+// installHooks writes the GitLite managed hooks into a bare repository.
+// A pre-receive hook that GitLite does not manage is moved to
+// pre-receive.local, which the managed hook runs; if that name is taken
+// as well the repository is left alone.
+func installHooks(repoPath string) error {
+	hooksDir := filepath.Join(repoPath, "hooks")
+	if err := os.MkdirAll(hooksDir, 0755); err != nil {
+		return err
+	}
+	hookPath := filepath.Join(hooksDir, "pre-receive")
+	localPath := filepath.Join(hooksDir, "pre-receive.local")
+	data, err := os.ReadFile(hookPath)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return err
+	case !strings.Contains(string(data), managedMarker):
+		if _, err := os.Lstat(localPath); err == nil {
+			return fmt.Errorf("%s is not managed by GitLite and %s already exists", hookPath, localPath)
+		}
+		if err := os.Rename(hookPath, localPath); err != nil {
+			return err
+		}
+	}
+	if err := os.WriteFile(hookPath, []byte(preReceiveHook), 0755); err != nil {
+		return err
+	}
+	return os.Chmod(hookPath, 0755)
+}
@@ -0,0 +1,190 @@
+package repo
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Maintenance tasks that can be run on a repository
+const (
+	TaskGC   = "gc"   // Repack and prune objects, pack refs and write the commit-graph
+	TaskFsck = "fsck" // Verify connectivity and validity of all objects
+)
+
+// maintenanceSteps lists the git commands run for each maintenance task.
+// git gc has no --progress option, it shows progress when run by runProgress.
+var maintenanceSteps = map[string][][]string{
+	TaskGC: {
+		{"gc"},
+		{"commit-graph", "write", "--reachable", "--progress"},
+	},
+	TaskFsck: {
+		{"fsck", "--full", "--progress", "--no-dangling"},
+	},
+}
+
+// MaintenanceRun records the outcome of a maintenance task
+type MaintenanceRun struct {
+	StartedAt time.Time     // Time the task started
+	Duration  time.Duration // How long the task took
+	OK        bool          // Whether all steps succeeded
+	Message   string        // Last line of output of a failed step
+}
+
+// maintenanceTask is a maintenance task in progress on a repository
+type maintenanceTask struct {
+	task string        // Name of the task
+	done chan struct{} // Closed when the task has ended
+}
+
+// ObjectStats summarizes the object storage of a repository
+type ObjectStats struct {
+	Loose int64 // Number of loose objects
+	Packs int64 // Number of pack files
+}
+
+// Maintain runs a maintenance task on a repository, writing git's output to
+// progress, and records the result. Only one task runs per repository at a time.
+func (m *Manager) Maintain(name, task string, progress io.Writer) (*MaintenanceRun, error) {
+	steps, ok := maintenanceSteps[task]
+	if !ok {
+		return nil, fmt.Errorf("unknown maintenance task: %s", task)
+	}
+	repoPath, err := m.existingPath(name)
+	if err != nil {
+		return nil, err
+	}
+
+	running, err := m.startTask(name, task)
+	if err != nil {
+		return nil, err
+	}
+	defer m.endTask(name, running)
+
+	if progress == nil {
+		progress = io.Discard
+	}
+	run := &MaintenanceRun{StartedAt: time.Now(), OK: true}
+	for _, args := range steps {
+		fmt.Fprintf(progress, "git %s\n", strings.Join(args, " "))
+		var output bytes.Buffer
+		cmd := exec.Command("git", append([]string{"--git-dir=" + repoPath}, args...)...)
+		if err := runProgress(cmd, io.MultiWriter(progress, &output)); err != nil {
+			run.OK = false
+			run.Message = lastLine(output.String())
+			if run.Message == "" {
+				run.Message = err.Error()
+			}
+			break
+		}
+	}
+	run.Duration = time.Since(run.StartedAt)
+
+	m.mu.Lock()
+	if repo, exists := m.repos[name]; exists {
+		if repo.Maintenance == nil {
+			repo.Maintenance = make(map[string]*MaintenanceRun)
+		}
+		repo.Maintenance[task] = run
+	}
+	m.mu.Unlock()
+	return run, nil
+}
+
+// startTask registers a maintenance task on a repository. gc is registered
+// inside the write fence, so it never starts while Snapshot links files;
+// Snapshot links a repository under gc once it has ended instead of fencing
+// pushes for the whole run. fsck only reads and ignores the fence.
+func (m *Manager) startTask(name, task string) (*maintenanceTask, error) {
+	if task == TaskGC {
+		m.fence.RLock()
+		defer m.fence.RUnlock()
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.maintaining[name] != nil {
+		return nil, fmt.Errorf("maintenance of %s is already running", name)
+	}
+	running := &maintenanceTask{task: task, done: make(chan struct{})}
+	m.maintaining[name] = running
+	return running, nil
+}
+
+// endTask unregisters a maintenance task started with startTask
+func (m *Manager) endTask(name string, running *maintenanceTask) {
+	m.mu.Lock()
+	delete(m.maintaining, name)
+	m.mu.Unlock()
+	close(running.done)
+}
+
+// runProgress runs a git command with its output written to w. Where
+// possible the output goes through a pseudo terminal, as git only shows the
+// progress of some commands, such as gc, on a terminal.
+func runProgress(cmd *exec.Cmd, w io.Writer) error {
+	ptm, pts, err := openPty()
+	if err != nil {
+		cmd.Stdout = w
+		cmd.Stderr = w
+		return cmd.Run()
+	}
+	defer ptm.Close()
+
+	cmd.Stdout = pts
+	cmd.Stderr = pts
+	err = cmd.Start()
+	pts.Close()
+	if err != nil {
+		return err
+	}
+	// Reading fails with EIO once git and its children have exited
+	io.Copy(w, ptm)
+	return cmd.Wait()
+}
+
+// ObjectStats counts the loose objects and packs of a repository
+func (m *Manager) ObjectStats(name string) (ObjectStats, error) {
+	var stats ObjectStats
+	repoPath, err := m.existingPath(name)
+	if err != nil {
+		return stats, err
+	}
+	out, err := outputGit(repoPath, nil, "count-objects", "-v")
+	if err != nil {
+		return stats, err
+	}
+	for _, line := range strings.Split(out, "\n") {
+		key, value, ok := strings.Cut(line, ": ")
+		if !ok {
+			continue
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+		if err != nil {
+			continue
+		}
+		switch key {
+		case "count":
+			stats.Loose = n
+		case "packs":
+			stats.Packs = n
+		}
+	}
+	return stats, nil
+}
+
+// lastLine returns the last non-empty line of git output, which may use \r for progress
+func lastLine(s string) string {
+	lines := strings.FieldsFunc(s, func(r rune) bool { return r == '\n' || r == '\r' })
+	for i := len(lines) - 1; i >= 0; i-- {
+		if line := strings.TrimSpace(lines[i]); line != "" {
+			return line
+		}
+	}
+	return ""
+}
@@ -0,0 +1,97 @@
+package repo
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// SetDescription sets the free-form description of a repository
+func (m *Manager) SetDescription(name, description string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	repo, exists := m.repos[name]
+	if !exists {
+		return &NotFoundError{Name: name}
+	}
+	repo.Description = strings.TrimSpace(description)
+	return nil
+}
+
+// SetOwner records the user responsible for a repository, empty clears it
+func (m *Manager) SetOwner(name, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	repo, exists := m.repos[name]
+	if !exists {
+		return &NotFoundError{Name: name}
+	}
+	repo.Owner = owner
+	return nil
+}
+
+// SetArchived marks a repository as archived, which makes it read-only for everyone
+func (m *Manager) SetArchived(name string, archived bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	repo, exists := m.repos[name]
+	if !exists {
+		return &NotFoundError{Name: name}
+	}
+	repo.Archived = archived
+	return nil
+}
+
+// RecordPush remembers the time of the latest successful push to a repository
+func (m *Manager) RecordPush(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if repo, exists := m.repos[name]; exists {
+		repo.LastPush = time.Now()
+	}
+}
+
+// DefaultBranch returns the branch HEAD of a repository points to
+func (m *Manager) DefaultBranch(name string) (string, error) {
+	repoPath, err := m.existingPath(name)
+	if err != nil {
+		return "", err
+	}
+	out, err := exec.Command("git", "--git-dir="+repoPath, "symbolic-ref", "--short", "HEAD").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to read HEAD: %v", err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// SetDefaultBranch points HEAD of a repository to a branch, which need not exist yet
+func (m *Manager) SetDefaultBranch(name, branch string) error {
+	repoPath, err := m.existingPath(name)
+	if err != nil {
+		return err
+	}
+	if strings.HasPrefix(branch, "-") || exec.Command("git", "check-ref-format", "--branch", branch).Run() != nil {
+		return fmt.Errorf("invalid branch name: %s", branch)
+	}
+	cmd := exec.Command("git", "--git-dir="+repoPath, "symbolic-ref", "HEAD", "refs/heads/"+branch)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to set HEAD: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// existingPath returns the verified path of a registered repository
+func (m *Manager) existingPath(name string) (string, error) {
+	m.mu.RLock()
+	repo, exists := m.repos[name]
+	m.mu.RUnlock()
+	if !exists {
+		return "", &NotFoundError{Name: name}
+	}
+	return m.checkPath(repo.Path)
+}
@@ -1,17 +1,124 @@
 package repo
 
+import (
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
 // Permission represents repository access permission levels
 type Permission int
 
 const (
-	PermNone  Permission = 0 // No access
-	PermRead  Permission = 1 // Read-only access
-	PermWrite Permission = 2 // Read and write access
+	PermNone     Permission = 0 // No access
+	PermRead     Permission = 1 // Read-only access
+	PermWrite    Permission = 2 // Read and write access
+	PermMaintain Permission = 3 // Read and write access, and managing the read and write grants
 )
 
+// String renders a permission as "r", "rw" or "maintain", the form used by
+// commands, the API and the data files, or "none" for PermNone
+func (p Permission) String() string {
+	switch p {
+	case PermRead:
+		return "r"
+	case PermWrite:
+		return "rw"
+	case PermMaintain:
+		return "maintain"
+	}
+	return "none"
+}
+
+// ParsePermission parses "r", "rw" or "maintain"
+func ParsePermission(s string) (Permission, bool) {
+	switch s {
+	case "r":
+		return PermRead, true
+	case "rw":
+		return PermWrite, true
+	case "maintain":
+		return PermMaintain, true
+	}
+	return PermNone, false
+}
+
 // Repository represents a git repository with user permissions
 type Repository struct {
-	Name  string                   // Repository name
-	Path  string                   // Full filesystem path to the repository
-	Users map[string]Permission    // Map of username to permission level
+	Name        string                     // Repository name
+	Path        string                     // Full filesystem path to the repository
+	Users       map[string]Permission      // Map of username to permission level
+	Quota       int64                      // Maximum on-disk size in bytes, 0 means unlimited
+	MaxBlobSize int64                      // Largest blob accepted on push in bytes, 0 means unlimited
+	DeployKeys  []*DeployKey               // Keys that grant access to this repository only
+	Aliases     map[string]time.Time       // Former names that still redirect here, with their expiry
+	Description string                     // Free-form description
+	Owner       string                     // User responsible for the repository, empty if none
+	Archived    bool                       // Archived repositories refuse all writes
+	LastPush    time.Time                  // Time of the latest successful push, zero if never
+	ForkOf      string                     // Repository this one was forked from, empty if none
+	Maintenance map[string]*MaintenanceRun // Latest result of each maintenance task
+}
+
+// clone returns a copy of the repository that shares no maps or keys with it
+func (r *Repository) clone() *Repository {
+	copied := *r
+	copied.Users = make(map[string]Permission, len(r.Users))
+	for u, p := range r.Users {
+		copied.Users[u] = p
+	}
+	copied.DeployKeys = make([]*DeployKey, len(r.DeployKeys))
+	for i, k := range r.DeployKeys {
+		key := *k
+		copied.DeployKeys[i] = &key
+	}
+	if r.Aliases != nil {
+		copied.Aliases = make(map[string]time.Time, len(r.Aliases))
+		for a, t := range r.Aliases {
+			copied.Aliases[a] = t
+		}
+	}
+	if r.Maintenance != nil {
+		copied.Maintenance = make(map[string]*MaintenanceRun, len(r.Maintenance))
+		for task, run := range r.Maintenance {
+			copiedRun := *run
+			copied.Maintenance[task] = &copiedRun
+		}
+	}
+	return &copied
+}
+
+// TrashEntry is a deleted repository kept in the trash until it is purged
+type TrashEntry struct {
+	ID        string      // Directory name inside the trash
+	Repo      *Repository // Repository record at the time of deletion
+	DeletedAt time.Time   // Time of deletion
+	ExpiresAt time.Time   // Time after which it is purged, zero keeps it until purged manually
+}
+
+// clone returns a copy of the entry with a copy of its repository record
+func (e *TrashEntry) clone() *TrashEntry {
+	copied := *e
+	copied.Repo = e.Repo.clone()
+	return &copied
+}
+
+// DeployKeyPrefix marks principal names that stand for a deploy key
+const DeployKeyPrefix = "deploy:"
+
+// DeployKey is an SSH key attached directly to a single repository
+type DeployKey struct {
+	Key  ssh.PublicKey // SSH public key
+	Perm Permission    // PermRead or PermWrite
+}
+
+// DeployKeyPrincipal returns the principal name a deploy key authenticates as
+func DeployKeyPrincipal(fingerprint string) string {
+	return DeployKeyPrefix + fingerprint
+}
+
+// IsDeployKeyPrincipal reports whether a principal name stands for a deploy key
+func IsDeployKeyPrincipal(name string) bool {
+	return strings.HasPrefix(name, DeployKeyPrefix)
 }
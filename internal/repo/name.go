@@ -0,0 +1,139 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// MaxNameLength is the maximum length of a repository name, including namespaces
+const MaxNameLength = 100
+
+// nameSegmentRegex matches one "/" separated segment of a repository name.
+// Names are restricted to ASCII, so differently normalized Unicode spellings
+// of the same name cannot exist side by side.
+var nameSegmentRegex = regexp.MustCompile(`^[a-zA-Z0-9_][a-zA-Z0-9_\-]*$`)
+
+// reservedNames cannot be used as a name segment because some filesystems
+// treat them as devices
+var reservedNames = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true,
+	"com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true,
+	"lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+// ValidateName checks a repository name without the ".git" suffix. Names
+// consist of "/" separated segments of letters, digits, "_" and "-".
+func ValidateName(name string) error {
+	if name == "" {
+		return fmt.Errorf("repository name is empty")
+	}
+	if len(name) > MaxNameLength {
+		return fmt.Errorf("repository name is longer than %d characters", MaxNameLength)
+	}
+	for _, segment := range strings.Split(name, "/") {
+		if !nameSegmentRegex.MatchString(segment) {
+			return fmt.Errorf("invalid repository name: %s", name)
+		}
+		if reservedNames[strings.ToLower(segment)] {
+			return fmt.Errorf("repository name uses reserved word: %s", segment)
+		}
+	}
+	return nil
+}
+
+// ParsePath converts a repository path as sent by git clients, such as
+// "/team/app.git", into a validated repository name
+func ParsePath(path string) (string, error) {
+	path = strings.TrimPrefix(path, "/")
+	name, ok := strings.CutSuffix(path, ".git")
+	if !ok {
+		return "", fmt.Errorf("invalid repo path: %s", path)
+	}
+	if err := ValidateName(name); err != nil {
+		return "", fmt.Errorf("invalid repo path: %s", path)
+	}
+	return name, nil
+}
+
+// reposRoot returns the directory that holds all repositories
+func (m *Manager) reposRoot() string {
+	return filepath.Join(m.basePath, "repos")
+}
+
+// resolvePath validates a repository name and returns its verified path on disk
+func (m *Manager) resolvePath(name string) (string, error) {
+	if err := ValidateName(name); err != nil {
+		return "", err
+	}
+	return m.checkPath(filepath.Join(m.reposRoot(), name+".git"))
+}
+
+// checkPath verifies that path lies inside the repos root after resolving
+// symlinks, and returns it as an absolute path
+func (m *Manager) checkPath(path string) (string, error) {
+	root, err := evalExisting(m.reposRoot())
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	resolved, err := evalExisting(abs)
+	if err != nil {
+		return "", err
+	}
+
+	rel, err := filepath.Rel(root, resolved)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s is outside the repository directory", path)
+	}
+	return abs, nil
+}
+
+// evalExisting resolves symlinks in the longest existing prefix of path and
+// appends the remaining, not yet existing, components
+func evalExisting(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	rest := ""
+	for {
+		resolved, err := filepath.EvalSymlinks(abs)
+		if err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			return filepath.Join(abs, rest), nil
+		}
+		rest = filepath.Join(filepath.Base(abs), rest)
+		abs = parent
+	}
+}
+
+// checkCaseCollision refuses names that only differ in case from an existing
+// repository, as they would clash on case-insensitive filesystems, and
+// names of repositories that are still being created. Callers hold m.mu.
+func (m *Manager) checkCaseCollision(name string) error {
+	for reserved := range m.reserved {
+		if strings.EqualFold(reserved, name) {
+			return fmt.Errorf("repository %s is being created", reserved)
+		}
+	}
+	for existing := range m.repos {
+		if existing != name && strings.EqualFold(existing, name) {
+			return fmt.Errorf("repository %s differs only in case from %s", name, existing)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package repo
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateName(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"app", true},
+		{"team/app", true},
+		{"a_b-c", true},
+		{"_private", true},
+		{"", false},
+		{"..", false},
+		{"../app", false},
+		{"team/../app", false},
+		{"./app", false},
+		{"/app", false},
+		{"app/", false},
+		{"team//app", false},
+		{"-app", false},
+		{"app.git", false},
+		{"app name", false},
+		{"app\\x", false},
+		{"café", false},
+		{"con", false},
+		{"team/LPT1", false},
+		{strings.Repeat("a", MaxNameLength), true},
+		{strings.Repeat("a", MaxNameLength+1), false},
+	}
+	for _, tt := range tests {
+		err := ValidateName(tt.name)
+		if (err == nil) != tt.ok {
+			t.Errorf("ValidateName(%q) = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+		ok   bool
+	}{
+		{"/app.git", "app", true},
+		{"team/app.git", "team/app", true},
+		{"/app", "", false},
+		{"/../app.git", "", false},
+		{"/team/../../app.git", "", false},
+		{"//etc/passwd.git", "", false},
+	}
+	for _, tt := range tests {
+		got, err := ParsePath(tt.path)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParsePath(%q) = %q, %v, want %q, ok %v", tt.path, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+// newTestManager returns a manager with an existing repos root and a
+// directory next to it that lies outside of that root
+func newTestManager(t *testing.T) (*Manager, string) {
+	t.Helper()
+	base := t.TempDir()
+	outside := filepath.Join(base, "outside")
+	for _, dir := range []string{filepath.Join(base, "repos", "team"), outside} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewManager(base), outside
+}
+
+func TestCheckPath(t *testing.T) {
+	m, outside := newTestManager(t)
+	root := m.reposRoot()
+	symlink := func(target, link string) {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+	}
+	symlink(outside, "escape.git")
+	symlink(outside, "escdir")
+	symlink(filepath.Join(root, "team"), "alias")
+
+	tests := []struct {
+		desc string
+		path string
+		ok   bool
+	}{
+		{"repository in root", filepath.Join(root, "app.git"), true},
+		{"namespaced repository", filepath.Join(root, "team", "app.git"), true},
+		{"not yet existing parents", filepath.Join(root, "new", "deep", "app.git"), true},
+		{"root itself", root, false},
+		{"dot dot to parent", filepath.Join(root, "..", "outside"), false},
+		{"dot dot inside", root + "/team/../app.git", true},
+		{"dot dot escaping", root + "/team/../../outside/app.git", false},
+		{"absolute path outside", outside, false},
+		{"system path", "/etc", false},
+		{"symlinked repository outside", filepath.Join(root, "escape.git"), false},
+		{"below symlink outside", filepath.Join(root, "escdir", "app.git"), false},
+		{"symlink inside root", filepath.Join(root, "alias", "app.git"), true},
+	}
+	for _, tt := range tests {
+		_, err := m.checkPath(tt.path)
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: checkPath(%q) = %v, want ok %v", tt.desc, tt.path, err, tt.ok)
+		}
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	m, outside := newTestManager(t)
+	root := m.reposRoot()
+	if err := os.Symlink(outside, filepath.Join(root, "evil")); err != nil {
+		t.Skipf("symlinks not supported: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"app", filepath.Join(root, "app.git")},
+		{"team/app", filepath.Join(root, "team", "app.git")},
+		{"../app", ""},
+		{"/etc/app", ""},
+		{"evil/app", ""},
+	}
+	for _, tt := range tests {
+		got, err := m.resolvePath(tt.name)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("resolvePath(%q) = %q, want error", tt.name, got)
+			}
+			continue
+		}
+		want, _ := filepath.Abs(tt.want)
+		if err != nil || got != want {
+			t.Errorf("resolvePath(%q) = %q, %v, want %q", tt.name, got, err, want)
+		}
+	}
+}
+
+func TestCheckCaseCollision(t *testing.T) {
+	m, _ := newTestManager(t)
+	m.repos["Team/App"] = &Repository{Name: "Team/App"}
+
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"Team/App", true},
+		{"team/app", false},
+		{"TEAM/APP", false},
+		{"team/app2", true},
+		{"other", true},
+	}
+	for _, tt := range tests {
+		err := m.checkCaseCollision(tt.name)
+		if (err == nil) != tt.ok {
+			t.Errorf("checkCaseCollision(%q) = %v, want ok %v", tt.name, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+//go:build linux
+
+package repo
+
+import (
+	"fmt"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// openPty opens a pseudo terminal without output processing and returns its
+// controlling and terminal side
+func openPty() (*os.File, *os.File, error) {
+	ptm, err := os.OpenFile("/dev/ptmx", os.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, nil, err
+	}
+	fd := int(ptm.Fd())
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		ptm.Close()
+		return nil, nil, err
+	}
+	n, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		ptm.Close()
+		return nil, nil, err
+	}
+	pts, err := os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|unix.O_NOCTTY|unix.O_CLOEXEC, 0)
+	if err != nil {
+		ptm.Close()
+		return nil, nil, err
+	}
+
+	// Keep line endings as git writes them
+	if termios, err := unix.IoctlGetTermios(int(pts.Fd()), unix.TCGETS); err == nil {
+		termios.Oflag &^= unix.OPOST
+		unix.IoctlSetTermios(int(pts.Fd()), unix.TCSETS, termios)
+	}
+	return ptm, pts, nil
+}
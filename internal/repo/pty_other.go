@@ -0,0 +1,13 @@
+//go:build !linux
+
+package repo
+
+import (
+	"errors"
+	"os"
+)
+
+// openPty is only supported on Linux, elsewhere git output goes through pipes
+func openPty() (*os.File, *os.File, error) {
+	return nil, nil, errors.New("pseudo terminals are not supported on this platform")
+}
@@ -0,0 +1,98 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Rename moves a repository to a new name together with its permissions and
+// settings. With a positive aliasFor the old name keeps redirecting to the
+// repository for that long.
+func (m *Manager) Rename(oldName, newName string, aliasFor time.Duration) error {
+	m.fence.RLock()
+	defer m.fence.RUnlock()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	repo, exists := m.repos[oldName]
+	if !exists {
+		return &NotFoundError{Name: oldName}
+	}
+	if err := m.checkIdle(oldName); err != nil {
+		return err
+	}
+	if _, exists := m.repos[newName]; exists {
+		return &ExistsError{Name: newName}
+	}
+	// Only a change of case is allowed to collide with the repository itself
+	delete(m.repos, oldName)
+	err := m.checkCaseCollision(newName)
+	m.repos[oldName] = repo
+	if err != nil {
+		return err
+	}
+
+	oldPath, err := m.checkPath(repo.Path)
+	if err != nil {
+		return err
+	}
+	newPath, err := m.resolvePath(newName)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(newPath); err == nil {
+		return fmt.Errorf("path %s already exists", newPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+		return err
+	}
+	if err := os.Rename(oldPath, newPath); err != nil {
+		return fmt.Errorf("failed to move repository: %v", err)
+	}
+
+	delete(m.repos, oldName)
+	m.dropAlias(newName)
+	repo.Name = newName
+	repo.Path = newPath
+	for _, r := range m.repos {
+		if r.ForkOf == oldName {
+			r.ForkOf = newName
+		}
+	}
+	if aliasFor > 0 {
+		if repo.Aliases == nil {
+			repo.Aliases = make(map[string]time.Time)
+		}
+		repo.Aliases[oldName] = time.Now().Add(aliasFor)
+	}
+	m.repos[newName] = repo
+	return nil
+}
+
+// ResolveAlias returns the current name of a renamed repository when name
+// is one of its former names and the redirect has not expired
+func (m *Manager) ResolveAlias(name string) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if _, exists := m.repos[name]; exists {
+		return "", false
+	}
+	now := time.Now()
+	for _, r := range m.repos {
+		if expires, ok := r.Aliases[name]; ok && now.Before(expires) {
+			return r.Name, true
+		}
+	}
+	return "", false
+}
+
+// dropAlias removes a former name from all repositories, because a
+// repository now uses it. Callers hold m.mu.
+func (m *Manager) dropAlias(name string) {
+	for _, r := range m.repos {
+		delete(r.Aliases, name)
+	}
+}
@@ -2,33 +2,110 @@ package repo
 
 import (
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
-	"path/filepath"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/touken928/gitlite/internal/storage"
+
+	"golang.org/x/crypto/ssh"
 )
 
 // RepoManager defines the interface for repository management
 type RepoManager interface {
 	// Create creates a new bare git repository
 	Create(name string) error
-	// Delete removes a repository and its data
+	// CreateFromTemplate creates a repository seeded from a template
+	CreateFromTemplate(name string, t *Template) error
+	// Templates returns all available repository templates
+	Templates() ([]*Template, error)
+	// Template loads a repository template by name
+	Template(name string) (*Template, error)
+	// Delete moves a repository and its permissions to the trash
 	Delete(name string) error
-	// Get returns a repository by name
+	// Get returns a copy of a repository by name, or nil if not found
 	Get(name string) *Repository
-	// List returns all repositories
+	// List returns copies of all repositories
 	List() []*Repository
 	// AddUser grants a user access to a repository
 	AddUser(repoName, userName string, perm Permission) error
 	// RemoveUser revokes a user's access to a repository
 	RemoveUser(repoName, userName string) error
+	// Grants returns a copy of the user grants of every repository
+	Grants() map[string]map[string]Permission
+	// Permission returns the permission granted to a user, PermNone if none
+	Permission(repoName, userName string) Permission
 	// CheckPermission verifies if a user has the required access
 	CheckPermission(repoName, userName string, needWrite bool) bool
-	// GetRepoPath returns the filesystem path for a repository
-	GetRepoPath(name string) string
+	// GetRepoPath returns the verified filesystem path for a repository
+	GetRepoPath(name string) (string, error)
+	// SetQuota sets the maximum on-disk size of a repository
+	SetQuota(name string, quota int64) error
+	// SetMaxBlobSize sets the largest blob accepted by a push
+	SetMaxBlobSize(name string, size int64) error
+	// Size returns the current on-disk size of a repository
+	Size(name string) (int64, error)
+	// UserUsage returns the total size of all repositories a user can write to
+	UserUsage(userName string) (int64, error)
+	// AddDeployKey attaches an SSH key to a single repository
+	AddDeployKey(repoName string, key ssh.PublicKey, perm Permission) error
+	// RemoveDeployKey removes a deploy key from a repository by fingerprint
+	RemoveDeployKey(repoName, fingerprint string) error
+	// ResolveDeployKey returns the principal name of a deploy key
+	ResolveDeployKey(key ssh.PublicKey) (string, bool)
+	// Scan finds bare repositories on disk that are not registered
+	Scan() ([]string, error)
+	// Import registers an existing bare repository
+	Import(name string) error
+	// Fork creates a space-saving copy of a repository
+	Fork(src, dst string) error
+	// Maintain runs a maintenance task on a repository and records the result
+	Maintain(name, task string, progress io.Writer) (*MaintenanceRun, error)
+	// ObjectStats counts the loose objects and packs of a repository
+	ObjectStats(name string) (ObjectStats, error)
+	// Rename moves a repository to a new name, optionally keeping the old one as an alias
+	Rename(oldName, newName string, aliasFor time.Duration) error
+	// ResolveAlias returns the current name of a renamed repository
+	ResolveAlias(name string) (string, bool)
+	// SetDescription sets the description of a repository
+	SetDescription(name, description string) error
+	// SetOwner records the user responsible for a repository
+	SetOwner(name, owner string) error
+	// SetArchived marks a repository as archived and read-only
+	SetArchived(name string, archived bool) error
+	// RecordPush remembers the time of the latest successful push
+	RecordPush(name string)
+	// DefaultBranch returns the branch HEAD points to
+	DefaultBranch(name string) (string, error)
+	// SetDefaultBranch points HEAD to a branch
+	SetDefaultBranch(name, branch string) error
+	// ListTrash returns copies of the deleted repositories kept in the trash
+	ListTrash() []*TrashEntry
+	// Restore moves a deleted repository back out of the trash
+	Restore(name string) error
+	// Purge permanently deletes trashed repositories by name, or all when empty
+	Purge(name string) ([]*TrashEntry, error)
+	// PurgeExpired permanently deletes trashed repositories past their retention
+	PurgeExpired(now time.Time) ([]*TrashEntry, error)
+	// ListTrashNamed returns the trash entries Purge would remove
+	ListTrashNamed(name string) []*TrashEntry
+	// ListTrashExpired returns the trash entries PurgeExpired would remove
+	ListTrashExpired(now time.Time) []*TrashEntry
+	// TrashEntryPath returns the directory holding a trashed repository
+	TrashEntryPath(e *TrashEntry) string
+	// TrashEntrySize returns the on-disk size of a trashed repository
+	TrashEntrySize(e *TrashEntry) (int64, error)
+	// BeginWrite marks the start of a change to a repository's data on disk
+	BeginWrite(name string)
+	// EndWrite marks the end of a change started with BeginWrite
+	EndWrite(name string)
+	// Snapshot hard links all repositories and their permissions into a
+	// directory, running capture while writes are fenced
+	Snapshot(dir string, capture func() error) error
 	// SaveToFile persists repository permissions to a JSON file
 	SaveToFile(path string) error
 	// LoadFromFile loads repository permissions from a JSON file
@@ -37,9 +114,15 @@ type RepoManager interface {
 
 // Manager handles repository management and provides thread-safe operations
 type Manager struct {
-	mu       sync.RWMutex
-	basePath string                 // Base directory for repository storage
-	repos    map[string]*Repository // Map of repository name to Repository struct
+	mu             sync.RWMutex
+	basePath       string                      // Base directory for repository storage
+	repos          map[string]*Repository      // Map of repository name to Repository struct
+	trash          []*TrashEntry               // Deleted repositories, oldest first
+	trashRetention time.Duration               // How long deleted repositories are kept, 0 means forever
+	maintaining    map[string]*maintenanceTask // Maintenance tasks in progress by repository name
+	reserved       map[string]bool             // Names of repositories being created without the lock held
+	writing        map[string]int              // Changes in progress by repository name, see BeginWrite
+	fence          sync.RWMutex                // Held shared by writes to repository data, exclusively by Snapshot
 }
 
 var _ RepoManager = (*Manager)(nil)
@@ -47,8 +130,11 @@ var _ RepoManager = (*Manager)(nil)
 // NewManager creates a new Manager instance
 func NewManager(basePath string) *Manager {
 	return &Manager{
-		basePath: basePath,
-		repos:    make(map[string]*Repository),
+		basePath:    basePath,
+		repos:       make(map[string]*Repository),
+		maintaining: make(map[string]*maintenanceTask),
+		reserved:    make(map[string]bool),
+		writing:     make(map[string]int),
 	}
 }
 
@@ -58,10 +144,19 @@ func (m *Manager) Create(name string) error {
 	defer m.mu.Unlock()
 
 	if _, exists := m.repos[name]; exists {
-		return fmt.Errorf("repository %s already exists", name)
+		return &ExistsError{Name: name}
+	}
+	if err := m.checkCaseCollision(name); err != nil {
+		return err
 	}
 
-	repoPath := filepath.Join(m.basePath, "repos", name+".git")
+	repoPath, err := m.resolvePath(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(repoPath); err == nil {
+		return fmt.Errorf("path %s already exists", repoPath)
+	}
 	if err := os.MkdirAll(repoPath, 0755); err != nil {
 		return err
 	}
@@ -73,7 +168,12 @@ func (m *Manager) Create(name string) error {
 		os.RemoveAll(repoPath)
 		return fmt.Errorf("failed to init repository: %v", err)
 	}
+	if err := installHooks(repoPath); err != nil {
+		os.RemoveAll(repoPath)
+		return fmt.Errorf("failed to install hooks: %v", err)
+	}
 
+	m.dropAlias(name)
 	m.repos[name] = &Repository{
 		Name:  name,
 		Path:  repoPath,
@@ -82,17 +182,33 @@ func (m *Manager) Create(name string) error {
 	return nil
 }
 
-// Delete removes a repository and its data from disk
+// Delete moves a repository and its permission record to the trash,
+// from where it can be restored until it is purged
 func (m *Manager) Delete(name string) error {
+	m.fence.RLock()
+	defer m.fence.RUnlock()
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	repo, exists := m.repos[name]
 	if !exists {
-		return fmt.Errorf("repository %s does not exist", name)
+		return &NotFoundError{Name: name}
+	}
+	if err := m.checkIdle(name); err != nil {
+		return err
 	}
 
-	if err := os.RemoveAll(repo.Path); err != nil {
+	// Never trust the stored path blindly, repos.json may have been edited
+	repoPath, err := m.checkPath(repo.Path)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(repoPath); os.IsNotExist(err) {
+		// Already gone from disk, there is nothing left to keep
+		delete(m.repos, name)
+		return nil
+	}
+	if err := m.moveToTrash(repo, repoPath); err != nil {
 		return err
 	}
 
@@ -100,22 +216,24 @@ func (m *Manager) Delete(name string) error {
 	return nil
 }
 
-// Get returns a repository by name
+// Get returns a copy of a repository by name, or nil if not found
 func (m *Manager) Get(name string) *Repository {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
-	name = strings.TrimSuffix(name, ".git")
-	return m.repos[name]
+	if r, exists := m.repos[strings.TrimSuffix(name, ".git")]; exists {
+		return r.clone()
+	}
+	return nil
 }
 
-// List returns all repositories
+// List returns copies of all repositories
 func (m *Manager) List() []*Repository {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	repos := make([]*Repository, 0, len(m.repos))
 	for _, r := range m.repos {
-		repos = append(repos, r)
+		repos = append(repos, r.clone())
 	}
 	return repos
 }
@@ -127,7 +245,7 @@ func (m *Manager) AddUser(repoName, userName string, perm Permission) error {
 
 	repo, exists := m.repos[repoName]
 	if !exists {
-		return fmt.Errorf("repository %s does not exist", repoName)
+		return &NotFoundError{Name: repoName}
 	}
 	repo.Users[userName] = perm
 	return nil
@@ -140,12 +258,42 @@ func (m *Manager) RemoveUser(repoName, userName string) error {
 
 	repo, exists := m.repos[repoName]
 	if !exists {
-		return fmt.Errorf("repository %s does not exist", repoName)
+		return &NotFoundError{Name: repoName}
 	}
 	delete(repo.Users, userName)
 	return nil
 }
 
+// Grants returns a copy of the user grants of every repository, keyed by
+// repository and user name
+func (m *Manager) Grants() map[string]map[string]Permission {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	grants := make(map[string]map[string]Permission, len(m.repos))
+	for name, r := range m.repos {
+		users := make(map[string]Permission, len(r.Users))
+		for u, p := range r.Users {
+			users[u] = p
+		}
+		grants[name] = users
+	}
+	return grants
+}
+
+// Permission returns the permission granted to a user on a repository,
+// PermNone if the repository does not exist or the user has no grant
+func (m *Manager) Permission(repoName, userName string) Permission {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	repo, exists := m.repos[strings.TrimSuffix(repoName, ".git")]
+	if !exists {
+		return PermNone
+	}
+	return repo.Users[userName]
+}
+
 // CheckPermission verifies if a user has the required access to a repository
 func (m *Manager) CheckPermission(repoName, userName string, needWrite bool) bool {
 	m.mu.RLock()
@@ -157,6 +305,11 @@ func (m *Manager) CheckPermission(repoName, userName string, needWrite bool) boo
 		return false
 	}
 
+	// Archived repositories are read-only for everyone
+	if needWrite && repo.Archived {
+		return false
+	}
+
 	// Guest access allows read-only for unauthenticated users
 	if !needWrite {
 		guestPerm, hasGuest := repo.Users["guest"]
@@ -170,6 +323,17 @@ func (m *Manager) CheckPermission(repoName, userName string, needWrite bool) boo
 		return false
 	}
 
+	// Deploy keys are only honored for the repository they are attached to
+	if IsDeployKeyPrincipal(userName) {
+		fingerprint := strings.TrimPrefix(userName, DeployKeyPrefix)
+		for _, dk := range repo.DeployKeys {
+			if ssh.FingerprintSHA256(dk.Key) == fingerprint {
+				return !needWrite || dk.Perm == PermWrite
+			}
+		}
+		return false
+	}
+
 	// Check user's permission
 	perm, ok := repo.Users[userName]
 	if !ok {
@@ -177,15 +341,133 @@ func (m *Manager) CheckPermission(repoName, userName string, needWrite bool) boo
 	}
 
 	if needWrite {
-		return perm == PermWrite
+		return perm >= PermWrite
 	}
 	return perm >= PermRead
 }
 
-// GetRepoPath returns the filesystem path for a repository
-func (m *Manager) GetRepoPath(name string) string {
-	name = strings.TrimSuffix(name, ".git")
-	return filepath.Join(m.basePath, "repos", name+".git")
+// GetRepoPath returns the filesystem path for a repository after verifying
+// that it resolves inside the repos directory
+func (m *Manager) GetRepoPath(name string) (string, error) {
+	return m.resolvePath(strings.TrimSuffix(name, ".git"))
+}
+
+// SetQuota sets the maximum on-disk size of a repository, 0 removes the limit
+func (m *Manager) SetQuota(name string, quota int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	repo, exists := m.repos[name]
+	if !exists {
+		return &NotFoundError{Name: name}
+	}
+	repo.Quota = quota
+	return nil
+}
+
+// SetMaxBlobSize sets the largest blob accepted by a push, 0 removes the limit
+func (m *Manager) SetMaxBlobSize(name string, size int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	repo, exists := m.repos[name]
+	if !exists {
+		return &NotFoundError{Name: name}
+	}
+	repo.MaxBlobSize = size
+	return nil
+}
+
+// Size returns the current on-disk size of a repository
+func (m *Manager) Size(name string) (int64, error) {
+	repo := m.Get(name)
+	if repo == nil {
+		return 0, &NotFoundError{Name: name}
+	}
+	return dirSize(repo.Path)
+}
+
+// UserUsage returns the total size of all repositories a user can write to
+func (m *Manager) UserUsage(userName string) (int64, error) {
+	m.mu.RLock()
+	paths := make([]string, 0)
+	for _, r := range m.repos {
+		if r.Users[userName] >= PermWrite {
+			paths = append(paths, r.Path)
+		}
+	}
+	m.mu.RUnlock()
+
+	var total int64
+	for _, p := range paths {
+		size, err := dirSize(p)
+		if err != nil {
+			return 0, err
+		}
+		total += size
+	}
+	return total, nil
+}
+
+// AddDeployKey attaches an SSH key to a single repository.
+// A key can only be a deploy key of one repository.
+func (m *Manager) AddDeployKey(repoName string, key ssh.PublicKey, perm Permission) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	repo, exists := m.repos[repoName]
+	if !exists {
+		return &NotFoundError{Name: repoName}
+	}
+	if perm != PermRead && perm != PermWrite {
+		return fmt.Errorf("invalid permission")
+	}
+
+	fingerprint := ssh.FingerprintSHA256(key)
+	for _, r := range m.repos {
+		for _, dk := range r.DeployKeys {
+			if ssh.FingerprintSHA256(dk.Key) == fingerprint {
+				return fmt.Errorf("key is already a deploy key of %s", r.Name)
+			}
+		}
+	}
+
+	repo.DeployKeys = append(repo.DeployKeys, &DeployKey{Key: key, Perm: perm})
+	return nil
+}
+
+// RemoveDeployKey removes a deploy key from a repository by fingerprint
+func (m *Manager) RemoveDeployKey(repoName, fingerprint string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	repo, exists := m.repos[repoName]
+	if !exists {
+		return &NotFoundError{Name: repoName}
+	}
+	for i, dk := range repo.DeployKeys {
+		if ssh.FingerprintSHA256(dk.Key) == fingerprint {
+			repo.DeployKeys = append(repo.DeployKeys[:i], repo.DeployKeys[i+1:]...)
+			return nil
+		}
+	}
+	return ErrKeyNotFound
+}
+
+// ResolveDeployKey returns the principal name of a deploy key, if the key is one
+func (m *Manager) ResolveDeployKey(key ssh.PublicKey) (string, bool) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	fingerprint := ssh.FingerprintSHA256(key)
+	for _, r := range m.repos {
+		for _, dk := range r.DeployKeys {
+			if ssh.FingerprintSHA256(dk.Key) == fingerprint {
+				return DeployKeyPrincipal(fingerprint), true
+			}
+		}
+	}
+	return "", false
 }
 
 // SaveToFile persists repository permissions to a JSON file
@@ -195,19 +477,7 @@ func (m *Manager) SaveToFile(path string) error {
 
 	repos := make([]storage.RepoPermission, 0, len(m.repos))
 	for _, r := range m.repos {
-		users := make(map[string]string)
-		for u, p := range r.Users {
-			if p == PermRead {
-				users[u] = "r"
-			} else if p == PermWrite {
-				users[u] = "rw"
-			}
-		}
-		repos = append(repos, storage.RepoPermission{
-			Name:  r.Name,
-			Path:  r.Path,
-			Users: users,
-		})
+		repos = append(repos, toRecord(r))
 	}
 
 	return storage.SaveRepoPermissions(path, repos)
@@ -227,34 +497,138 @@ func (m *Manager) LoadFromFile(path string) error {
 	defer m.mu.Unlock()
 
 	for _, rd := range repoData {
-		// Only restore permissions if the repository exists on disk
-		if _, err := os.Stat(rd.Path); os.IsNotExist(err) {
+		// Skip invalid names and paths that escape the repos directory
+		if ValidateName(rd.Name) != nil {
 			continue
 		}
-
-		users := make(map[string]Permission)
-		for u, pStr := range rd.Users {
-			var perm Permission
-			switch pStr {
-			case "r":
-				perm = PermRead
-			case "rw":
-				perm = PermWrite
-			default:
+		// Only restore permissions if the repository exists on disk; a stale
+		// path, e.g. after the data directory moved, is looked up by name
+		path, err := m.checkPath(rd.Path)
+		if err == nil {
+			_, err = os.Stat(path)
+		}
+		if err != nil {
+			if path, err = m.resolvePath(rd.Name); err != nil || !isBareRepo(path) {
 				continue
 			}
-			users[u] = perm
 		}
 
 		// Only add if not already exists
 		if _, exists := m.repos[rd.Name]; !exists {
-			m.repos[rd.Name] = &Repository{
-				Name:  rd.Name,
-				Path:  rd.Path,
-				Users: users,
-			}
+			r := fromRecord(rd)
+			r.Path = path
+			m.repos[rd.Name] = r
+			// Repositories created by older versions have no managed hooks yet;
+			// a failure here only disables the blob size check for this repo
+			installHooks(path)
 		}
 	}
 
 	return nil
 }
+
+// toRecord converts a repository to its persisted form
+func toRecord(r *Repository) storage.RepoPermission {
+	users := make(map[string]string)
+	for u, p := range r.Users {
+		if p != PermNone {
+			users[u] = p.String()
+		}
+	}
+	deployKeys := make([]storage.DeployKey, 0, len(r.DeployKeys))
+	for _, dk := range r.DeployKeys {
+		deployKeys = append(deployKeys, storage.DeployKey{
+			Key:  strings.TrimSpace(string(ssh.MarshalAuthorizedKey(dk.Key))),
+			Perm: dk.Perm.String(),
+		})
+	}
+	now := time.Now()
+	aliases := make([]storage.RepoAlias, 0, len(r.Aliases))
+	for name, expires := range r.Aliases {
+		if now.Before(expires) {
+			aliases = append(aliases, storage.RepoAlias{Name: name, ExpiresAt: expires})
+		}
+	}
+	sort.Slice(aliases, func(i, j int) bool { return aliases[i].Name < aliases[j].Name })
+	var lastPush *time.Time
+	if !r.LastPush.IsZero() {
+		lastPush = storage.TimePtr(r.LastPush)
+	}
+	var maintenance map[string]storage.MaintenanceRun
+	if len(r.Maintenance) > 0 {
+		maintenance = make(map[string]storage.MaintenanceRun)
+		for task, run := range r.Maintenance {
+			maintenance[task] = storage.MaintenanceRun{
+				StartedAt:  run.StartedAt,
+				DurationMs: run.Duration.Milliseconds(),
+				OK:         run.OK,
+				Message:    run.Message,
+			}
+		}
+	}
+	return storage.RepoPermission{
+		Name:        r.Name,
+		Path:        r.Path,
+		Users:       users,
+		Quota:       r.Quota,
+		MaxBlobSize: r.MaxBlobSize,
+		DeployKeys:  deployKeys,
+		Aliases:     aliases,
+		Description: r.Description,
+		Owner:       r.Owner,
+		Archived:    r.Archived,
+		LastPush:    lastPush,
+		ForkOf:      r.ForkOf,
+		Maintenance: maintenance,
+	}
+}
+
+// fromRecord converts a persisted repository record, skipping invalid entries
+func fromRecord(rd storage.RepoPermission) *Repository {
+	users := make(map[string]Permission)
+	for u, pStr := range rd.Users {
+		if perm, ok := ParsePermission(pStr); ok {
+			users[u] = perm
+		}
+	}
+	deployKeys := make([]*DeployKey, 0, len(rd.DeployKeys))
+	for _, dk := range rd.DeployKeys {
+		perm, ok := ParsePermission(dk.Perm)
+		keys := storage.LoadSSHKeys([]string{dk.Key})
+		if !ok || len(keys) == 0 {
+			continue // Skip invalid entries
+		}
+		deployKeys = append(deployKeys, &DeployKey{Key: keys[0], Perm: perm})
+	}
+	now := time.Now()
+	aliases := make(map[string]time.Time)
+	for _, a := range rd.Aliases {
+		if now.Before(a.ExpiresAt) && ValidateName(a.Name) == nil {
+			aliases[a.Name] = a.ExpiresAt
+		}
+	}
+	maintenance := make(map[string]*MaintenanceRun)
+	for task, run := range rd.Maintenance {
+		maintenance[task] = &MaintenanceRun{
+			StartedAt: run.StartedAt,
+			Duration:  time.Duration(run.DurationMs) * time.Millisecond,
+			OK:        run.OK,
+			Message:   run.Message,
+		}
+	}
+	return &Repository{
+		Name:        rd.Name,
+		Path:        rd.Path,
+		Users:       users,
+		Quota:       rd.Quota,
+		MaxBlobSize: rd.MaxBlobSize,
+		DeployKeys:  deployKeys,
+		Aliases:     aliases,
+		Description: rd.Description,
+		Owner:       rd.Owner,
+		Archived:    rd.Archived,
+		LastPush:    storage.TimeValue(rd.LastPush),
+		ForkOf:      rd.ForkOf,
+		Maintenance: maintenance,
+	}
+}
@@ -0,0 +1,86 @@
+package repo
+
+import (
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Scan looks for bare repositories below the repos directory that are not
+// registered yet, for example after copying them from another server or
+// losing repos.json. It returns their names sorted alphabetically.
+func (m *Manager) Scan() ([]string, error) {
+	root := m.reposRoot()
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	found := make([]string, 0)
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() || path == root || !strings.HasSuffix(d.Name(), ".git") {
+			return nil
+		}
+
+		// Never descend into a repository, nested repos are not supported
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		name := strings.TrimSuffix(filepath.ToSlash(rel), ".git")
+		if _, exists := m.repos[name]; !exists && !m.reserved[name] && isBareRepo(path) {
+			found = append(found, name)
+		}
+		return filepath.SkipDir
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(found)
+	return found, nil
+}
+
+// Import registers an existing bare repository found by Scan with no permissions
+func (m *Manager) Import(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.repos[name]; exists {
+		return &ExistsError{Name: name}
+	}
+	if err := m.checkCaseCollision(name); err != nil {
+		return err
+	}
+
+	repoPath, err := m.resolvePath(name)
+	if err != nil {
+		return err
+	}
+	if !isBareRepo(repoPath) {
+		return fmt.Errorf("%s is not a bare git repository", repoPath)
+	}
+	if err := installHooks(repoPath); err != nil {
+		return fmt.Errorf("failed to install hooks: %v", err)
+	}
+
+	m.dropAlias(name)
+	m.repos[name] = &Repository{
+		Name:  name,
+		Path:  repoPath,
+		Users: make(map[string]Permission),
+	}
+	return nil
+}
+
+// isBareRepo reports whether path is a valid bare git repository
+func isBareRepo(path string) bool {
+	// --git-dir prevents git from discovering a repository in a parent directory
+	out, err := exec.Command("git", "--git-dir="+path, "rev-parse", "--is-bare-repository").Output()
+	return err == nil && strings.TrimSpace(string(out)) == "true"
+}
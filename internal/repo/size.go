@@ -0,0 +1,93 @@
+package repo
+
+import (
+	"fmt"
+	"io/fs"
+	"math"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// sizeUnits maps size suffixes to their multipliers in bytes
+var sizeUnits = map[string]int64{
+	"":  1,
+	"B": 1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+	"T": 1 << 40,
+}
+
+// ParseSize parses a human readable size such as "500M" or "2G" into bytes.
+// "0", "none" and "unlimited" all return 0, which means no limit.
+func ParseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	if s == "NONE" || s == "UNLIMITED" {
+		return 0, nil
+	}
+
+	// Accept K, KB and KiB style suffixes alike
+	s = strings.TrimSuffix(s, "IB")
+	if len(s) > 1 && s[len(s)-1] == 'B' {
+		s = s[:len(s)-1]
+	}
+
+	i := len(s)
+	for i > 0 && (s[i-1] < '0' || s[i-1] > '9') && s[i-1] != '.' {
+		i--
+	}
+	mult, ok := sizeUnits[s[i:]]
+	if !ok {
+		return 0, fmt.Errorf("invalid size unit: %s", s[i:])
+	}
+
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %s", s)
+	}
+	// float64(math.MaxInt64) rounds up to 2^63, which no longer fits
+	size := n * float64(mult)
+	if math.IsInf(size, 0) || math.IsNaN(size) || size >= float64(math.MaxInt64) {
+		return 0, fmt.Errorf("size too large: %s", s)
+	}
+	// A size that rounds to 0 would silently mean no limit
+	if n > 0 && int64(size) == 0 {
+		return 0, fmt.Errorf("size is less than one byte: %s", s)
+	}
+	return int64(size), nil
+}
+
+// FormatSize renders a byte count in the largest fitting binary unit
+func FormatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// dirSize returns the total size of all regular files below path
+func dirSize(path string) (int64, error) {
+	var size int64
+	err := filepath.WalkDir(path, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		size += info.Size()
+		return nil
+	})
+	return size, err
+}
@@ -0,0 +1,43 @@
+package repo
+
+import "testing"
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+		ok   bool
+	}{
+		{"0", 0, true},
+		{"none", 0, true},
+		{"Unlimited", 0, true},
+		{"100", 100, true},
+		{"100B", 100, true},
+		{"1K", 1 << 10, true},
+		{"1KB", 1 << 10, true},
+		{"1KiB", 1 << 10, true},
+		{" 500m ", 500 << 20, true},
+		{"1.5G", 3 << 29, true},
+		{"0.5K", 512, true},
+		{"1.9", 1, true},
+		{"8191P", 0, false},
+		{"8388607T", 8388607 << 40, true},
+		{"8388608T", 0, false},
+		{"99999999T", 0, false},
+		{"1e30", 0, false},
+		{"0.4", 0, false},
+		{"0.5B", 0, false},
+		{"0.0001K", 0, false},
+		{"-1", 0, false},
+		{"", 0, false},
+		{"abc", 0, false},
+		{"1X", 0, false},
+		{"1.2.3M", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseSize(tt.in)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("ParseSize(%q) = %d, %v, want %d, ok %v", tt.in, got, err, tt.want, tt.ok)
+		}
+	}
+}
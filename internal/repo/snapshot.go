@@ -0,0 +1,134 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/touken928/gitlite/internal/storage"
+)
+
+// BeginWrite marks the start of a change to the data of a repository on
+// disk, such as a push. Snapshot waits until all such changes have ended,
+// and the repository is not moved by Rename or Delete until EndWrite.
+func (m *Manager) BeginWrite(name string) {
+	m.fence.RLock()
+	m.mu.Lock()
+	m.writing[name]++
+	m.mu.Unlock()
+}
+
+// EndWrite marks the end of a change started with BeginWrite
+func (m *Manager) EndWrite(name string) {
+	m.mu.Lock()
+	if m.writing[name]--; m.writing[name] <= 0 {
+		delete(m.writing, name)
+	}
+	m.mu.Unlock()
+	m.fence.RUnlock()
+}
+
+// checkIdle fails while git may be working in a repository, as moving its
+// directory would pull it from under the running process. m.mu must be held.
+func (m *Manager) checkIdle(name string) error {
+	if t := m.maintaining[name]; t != nil {
+		return fmt.Errorf("%s of %s is running, try again once it has finished", t.task, name)
+	}
+	if m.writing[name] > 0 {
+		return fmt.Errorf("a push to %s is in progress, try again once it has finished", name)
+	}
+	return nil
+}
+
+// Snapshot hard links every repository into dir/repos and writes the
+// matching dir/repos.json. Writes are fenced only while the links are
+// created. Git replaces files by renaming new ones into place, so the
+// linked files keep their content after the fence is lifted. capture, if
+// set, runs inside the fence so data saved with it matches the snapshot.
+// A repository under gc is linked once gc has ended, so pushes do not wait
+// for it.
+func (m *Manager) Snapshot(dir string, capture func() error) error {
+	m.fence.Lock()
+
+	// Only the records are taken under the lock, linking the files could
+	// otherwise hold up every session
+	m.mu.RLock()
+	records := make([]storage.RepoPermission, 0, len(m.repos))
+	deferred := make(map[string]*maintenanceTask)
+	for name, r := range m.repos {
+		records = append(records, toRecord(r))
+		if t := m.maintaining[name]; t != nil && t.task == TaskGC {
+			deferred[name] = t
+		}
+	}
+	m.mu.RUnlock()
+
+	var err error
+	for _, rd := range records {
+		if deferred[rd.Name] == nil {
+			if err = m.linkRepo(dir, rd.Name, rd.Path); err != nil {
+				break
+			}
+		}
+	}
+	if err == nil && capture != nil {
+		err = capture()
+	}
+	m.fence.Unlock()
+	if err != nil {
+		return err
+	}
+
+	for name, t := range deferred {
+		if err := m.linkAfterGC(dir, name, t); err != nil {
+			return err
+		}
+	}
+	return storage.SaveRepoPermissions(filepath.Join(dir, "repos.json"), records)
+}
+
+// linkAfterGC waits for gc on a repository to end and links it into dir
+// while writes are fenced
+func (m *Manager) linkAfterGC(dir, name string, running *maintenanceTask) error {
+	for {
+		<-running.done
+
+		m.fence.Lock()
+		m.mu.RLock()
+		r, exists := m.repos[name]
+		var repoPath string
+		if exists {
+			repoPath = r.Path
+		}
+		next := m.maintaining[name]
+		m.mu.RUnlock()
+
+		if next == nil || next.task != TaskGC {
+			err := fmt.Errorf("repository %s was removed or renamed during the snapshot", name)
+			if exists {
+				err = m.linkRepo(dir, name, repoPath)
+			}
+			m.fence.Unlock()
+			return err
+		}
+		// Another gc started before the fence was taken
+		m.fence.Unlock()
+		running = next
+	}
+}
+
+// linkRepo hard links the repository at repoPath into dir/repos
+func (m *Manager) linkRepo(dir, name, repoPath string) error {
+	repoPath, err := m.checkPath(repoPath)
+	if err != nil {
+		return err
+	}
+	dst := filepath.Join(dir, "repos", name+".git")
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	if err := linkTree(repoPath, dst); err != nil {
+		return fmt.Errorf("failed to snapshot %s: %v", name, err)
+	}
+	return nil
+}
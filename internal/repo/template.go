@@ -0,0 +1,233 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/touken928/gitlite/internal/storage"
+)
+
+// Template describes a directory below data/templates used to seed new
+// repositories. It holds either a files/ tree that becomes the initial
+// commit or a bare repo.git/ whose branches and tags are copied, plus an
+// optional hooks/ directory and template.json.
+type Template struct {
+	Name          string                // Template name
+	Dir           string                // Template directory
+	Description   string                // Description given to new repositories
+	DefaultBranch string                // Branch HEAD points to, empty keeps the git default
+	Permissions   map[string]Permission // Grants given to new repositories
+}
+
+// templatesDir returns the directory holding repository templates
+func (m *Manager) templatesDir() string {
+	return filepath.Join(m.basePath, "templates")
+}
+
+// Templates returns all available templates sorted by name
+func (m *Manager) Templates() ([]*Template, error) {
+	entries, err := os.ReadDir(m.templatesDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*Template{}, nil
+		}
+		return nil, err
+	}
+
+	templates := make([]*Template, 0, len(entries))
+	for _, e := range entries {
+		if !e.IsDir() || !nameSegmentRegex.MatchString(e.Name()) {
+			continue
+		}
+		t, err := m.Template(e.Name())
+		if err != nil {
+			return nil, err
+		}
+		templates = append(templates, t)
+	}
+	sort.Slice(templates, func(i, j int) bool { return templates[i].Name < templates[j].Name })
+	return templates, nil
+}
+
+// Template loads a template by name
+func (m *Manager) Template(name string) (*Template, error) {
+	if !nameSegmentRegex.MatchString(name) {
+		return nil, fmt.Errorf("invalid template name: %s", name)
+	}
+	dir := filepath.Join(m.templatesDir(), name)
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, fmt.Errorf("template %s does not exist", name)
+	}
+
+	cfg, err := storage.LoadTemplateConfig(filepath.Join(dir, "template.json"))
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %v", name, err)
+	}
+	perms := make(map[string]Permission)
+	for u, pStr := range cfg.Permissions {
+		perm, ok := ParsePermission(pStr)
+		if !ok {
+			return nil, fmt.Errorf("template %s: invalid permission %q for %s", name, pStr, u)
+		}
+		perms[u] = perm
+	}
+
+	return &Template{
+		Name:          name,
+		Dir:           dir,
+		Description:   cfg.Description,
+		DefaultBranch: cfg.DefaultBranch,
+		Permissions:   perms,
+	}, nil
+}
+
+// CreateFromTemplate creates a repository seeded with the content and hooks
+// of a template. Template permissions are left to the caller, since they
+// refer to users this package does not know about.
+func (m *Manager) CreateFromTemplate(name string, t *Template) error {
+	m.BeginWrite(name)
+	defer m.EndWrite(name)
+
+	if err := m.Create(name); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	repo := m.repos[name]
+	repo.Description = t.Description
+	repoPath := repo.Path
+	m.mu.Unlock()
+
+	if err := seedRepository(repoPath, t); err != nil {
+		// Nothing can have been pushed yet, so the repository is removed outright
+		m.mu.Lock()
+		delete(m.repos, name)
+		m.mu.Unlock()
+		os.RemoveAll(repoPath)
+		return fmt.Errorf("failed to apply template %s: %v", t.Name, err)
+	}
+	return nil
+}
+
+// seedRepository copies the content and hooks of a template into a new repository
+func seedRepository(repoPath string, t *Template) error {
+	if t.DefaultBranch != "" {
+		if strings.HasPrefix(t.DefaultBranch, "-") ||
+			exec.Command("git", "check-ref-format", "--branch", t.DefaultBranch).Run() != nil {
+			return fmt.Errorf("invalid default branch: %s", t.DefaultBranch)
+		}
+		if err := runGit(repoPath, nil, "symbolic-ref", "HEAD", "refs/heads/"+t.DefaultBranch); err != nil {
+			return err
+		}
+	}
+
+	filesDir := filepath.Join(t.Dir, "files")
+	bareDir := filepath.Join(t.Dir, "repo.git")
+	if isDir(bareDir) {
+		if err := runGit(repoPath, nil, "fetch", "--quiet", bareDir,
+			"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*"); err != nil {
+			return err
+		}
+		// Without a configured branch, HEAD follows the template repository
+		if t.DefaultBranch == "" {
+			if head, err := outputGit(bareDir, nil, "symbolic-ref", "HEAD"); err == nil {
+				if err := runGit(repoPath, nil, "symbolic-ref", "HEAD", head); err != nil {
+					return err
+				}
+			}
+		}
+	} else if isDir(filesDir) {
+		if err := commitTree(repoPath, filesDir); err != nil {
+			return err
+		}
+	}
+
+	return copyTemplateHooks(filepath.Join(t.Dir, "hooks"), filepath.Join(repoPath, "hooks"))
+}
+
+// commitTree records the content of dir as the initial commit on the branch HEAD points to
+func commitTree(repoPath, dir string) error {
+	index, err := os.CreateTemp("", "gitlite-index-")
+	if err != nil {
+		return err
+	}
+	index.Close()
+	os.Remove(index.Name()) // git refuses to read an empty index file
+	defer os.Remove(index.Name())
+
+	env := []string{
+		"GIT_INDEX_FILE=" + index.Name(),
+		"GIT_AUTHOR_NAME=GitLite", "GIT_AUTHOR_EMAIL=gitlite@localhost",
+		"GIT_COMMITTER_NAME=GitLite", "GIT_COMMITTER_EMAIL=gitlite@localhost",
+	}
+	if err := runGit(repoPath, env, "--work-tree="+dir, "add", "--all"); err != nil {
+		return err
+	}
+	tree, err := outputGit(repoPath, env, "write-tree")
+	if err != nil {
+		return err
+	}
+	commit, err := outputGit(repoPath, env, "commit-tree", tree, "-m", "Initial commit")
+	if err != nil {
+		return err
+	}
+	return runGit(repoPath, env, "update-ref", "HEAD", commit)
+}
+
+// copyTemplateHooks copies template hooks into a repository. A template
+// pre-receive hook becomes pre-receive.local, so the managed hook still runs first.
+func copyTemplateHooks(srcDir, dstDir string) error {
+	entries, err := os.ReadDir(srcDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	for _, e := range entries {
+		if !e.Type().IsRegular() {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(srcDir, e.Name()))
+		if err != nil {
+			return err
+		}
+		dst := e.Name()
+		if dst == "pre-receive" {
+			dst = "pre-receive.local"
+		}
+		if err := os.WriteFile(filepath.Join(dstDir, dst), data, 0755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runGit runs a git command against a bare repository
+func runGit(repoPath string, env []string, args ...string) error {
+	_, err := outputGit(repoPath, env, args...)
+	return err
+}
+
+// outputGit runs a git command against a bare repository and returns its trimmed output
+func outputGit(repoPath string, env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"--git-dir=" + repoPath}, args...)...)
+	cmd.Env = append(os.Environ(), env...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// isDir reports whether path is an existing directory
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
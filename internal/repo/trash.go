@@ -0,0 +1,305 @@
+package repo
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/touken928/gitlite/internal/storage"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// SetTrashRetention sets how long deleted repositories stay in the trash,
+// 0 keeps them until purged manually
+func (m *Manager) SetTrashRetention(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.trashRetention = d
+}
+
+// trashDir returns the directory holding deleted repositories
+func (m *Manager) trashDir() string {
+	return filepath.Join(m.basePath, "trash")
+}
+
+// trashPath returns the directory of a trash entry
+func (m *Manager) trashPath(id string) string {
+	return filepath.Join(m.trashDir(), id+".git")
+}
+
+// moveToTrash moves a repository directory into the trash and records it.
+// Callers hold m.mu.
+func (m *Manager) moveToTrash(r *Repository, repoPath string) error {
+	if err := os.MkdirAll(m.trashDir(), 0755); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	id := fmt.Sprintf("%d-%s", now.UnixNano(), strings.ReplaceAll(r.Name, "/", "_"))
+	if err := os.Rename(repoPath, m.trashPath(id)); err != nil {
+		return fmt.Errorf("failed to move repository to trash: %v", err)
+	}
+
+	entry := &TrashEntry{ID: id, Repo: r, DeletedAt: now}
+	if m.trashRetention > 0 {
+		entry.ExpiresAt = now.Add(m.trashRetention)
+	}
+	m.trash = append(m.trash, entry)
+	if err := m.saveTrash(); err != nil {
+		// Undo the move so the trash never holds unindexed repositories
+		os.Rename(m.trashPath(id), repoPath)
+		m.trash = m.trash[:len(m.trash)-1]
+		return err
+	}
+	return nil
+}
+
+// ListTrash returns copies of the deleted repositories, oldest first
+func (m *Manager) ListTrash() []*TrashEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := make([]*TrashEntry, len(m.trash))
+	for i, e := range m.trash {
+		entries[i] = e.clone()
+	}
+	return entries
+}
+
+// Restore moves the most recently deleted repository with the given name
+// back out of the trash. Deploy keys given to another repository in the
+// meantime are dropped.
+func (m *Manager) Restore(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	idx := -1
+	for i, e := range m.trash {
+		if e.Repo.Name == name {
+			idx = i
+		}
+	}
+	if idx < 0 {
+		return fmt.Errorf("repository %s is not in the trash", name)
+	}
+	if _, exists := m.repos[name]; exists {
+		return &ExistsError{Name: name}
+	}
+	if err := m.checkCaseCollision(name); err != nil {
+		return err
+	}
+
+	repoPath, err := m.resolvePath(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(repoPath); err == nil {
+		return fmt.Errorf("path %s already exists", repoPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(repoPath), 0755); err != nil {
+		return err
+	}
+
+	entry := m.trash[idx]
+	if err := os.Rename(m.trashPath(entry.ID), repoPath); err != nil {
+		return fmt.Errorf("failed to restore repository: %v", err)
+	}
+
+	r := entry.Repo
+	r.Path = repoPath
+	r.DeployKeys = m.unusedDeployKeys(r.DeployKeys)
+	m.dropAlias(name)
+	m.repos[name] = r
+	m.trash = append(m.trash[:idx], m.trash[idx+1:]...)
+	return m.saveTrash()
+}
+
+// Purge permanently deletes the trashed copies of a repository, or the
+// whole trash when name is empty, and returns the removed entries
+func (m *Manager) Purge(name string) ([]*TrashEntry, error) {
+	return m.purge(trashNamed(name))
+}
+
+// PurgeExpired permanently deletes trash entries whose retention has passed
+func (m *Manager) PurgeExpired(now time.Time) ([]*TrashEntry, error) {
+	return m.purge(trashExpired(now))
+}
+
+// ListTrashNamed returns the trash entries that Purge(name) would remove
+func (m *Manager) ListTrashNamed(name string) []*TrashEntry {
+	return m.filterTrash(trashNamed(name))
+}
+
+// ListTrashExpired returns the trash entries that PurgeExpired(now) would remove
+func (m *Manager) ListTrashExpired(now time.Time) []*TrashEntry {
+	return m.filterTrash(trashExpired(now))
+}
+
+// TrashEntryPath returns the directory holding a trashed repository
+func (m *Manager) TrashEntryPath(e *TrashEntry) string {
+	return m.trashPath(e.ID)
+}
+
+// TrashEntrySize returns the on-disk size of a trashed repository
+func (m *Manager) TrashEntrySize(e *TrashEntry) (int64, error) {
+	return dirSize(m.trashPath(e.ID))
+}
+
+// trashNamed matches the trashed copies of a repository, or every entry
+// when name is empty
+func trashNamed(name string) func(e *TrashEntry) bool {
+	return func(e *TrashEntry) bool {
+		return name == "" || e.Repo.Name == name
+	}
+}
+
+// trashExpired matches trash entries whose retention has passed
+func trashExpired(now time.Time) func(e *TrashEntry) bool {
+	return func(e *TrashEntry) bool {
+		return !e.ExpiresAt.IsZero() && !now.Before(e.ExpiresAt)
+	}
+}
+
+// filterTrash returns copies of the trash entries matching a filter
+func (m *Manager) filterTrash(match func(e *TrashEntry) bool) []*TrashEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	entries := make([]*TrashEntry, 0)
+	for _, e := range m.trash {
+		if match(e) {
+			entries = append(entries, e.clone())
+		}
+	}
+	return entries
+}
+
+// purge removes the trash entries matching a filter. The entries leave
+// the index under the lock, their directories are deleted after it is
+// released, as that can take long for large repositories.
+func (m *Manager) purge(match func(e *TrashEntry) bool) ([]*TrashEntry, error) {
+	m.mu.Lock()
+	matched := make([]*TrashEntry, 0)
+	kept := make([]*TrashEntry, 0, len(m.trash))
+	for _, e := range m.trash {
+		if match(e) {
+			matched = append(matched, e)
+		} else {
+			kept = append(kept, e)
+		}
+	}
+	if len(matched) == 0 {
+		m.mu.Unlock()
+		return matched, nil
+	}
+	previous := m.trash
+	m.trash = kept
+	if err := m.saveTrash(); err != nil {
+		m.trash = previous
+		m.mu.Unlock()
+		return nil, err
+	}
+	m.mu.Unlock()
+
+	purged := make([]*TrashEntry, 0, len(matched))
+	failed := make([]*TrashEntry, 0)
+	var firstErr error
+	for _, e := range matched {
+		if err := os.RemoveAll(m.trashPath(e.ID)); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			failed = append(failed, e)
+			continue
+		}
+		purged = append(purged, e)
+	}
+
+	// Entries that could not be deleted go back into the index
+	if len(failed) > 0 {
+		m.mu.Lock()
+		m.trash = append(m.trash, failed...)
+		sort.SliceStable(m.trash, func(i, j int) bool { return m.trash[i].DeletedAt.Before(m.trash[j].DeletedAt) })
+		if err := m.saveTrash(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		m.mu.Unlock()
+	}
+	return purged, firstErr
+}
+
+// unusedDeployKeys filters out keys that are deploy keys of a registered
+// repository. Callers hold m.mu.
+func (m *Manager) unusedDeployKeys(keys []*DeployKey) []*DeployKey {
+	inUse := make(map[string]bool)
+	for _, r := range m.repos {
+		for _, dk := range r.DeployKeys {
+			inUse[ssh.FingerprintSHA256(dk.Key)] = true
+		}
+	}
+
+	free := make([]*DeployKey, 0, len(keys))
+	for _, dk := range keys {
+		if !inUse[ssh.FingerprintSHA256(dk.Key)] {
+			free = append(free, dk)
+		}
+	}
+	return free
+}
+
+// saveTrash writes the trash index next to the trashed repositories.
+// Callers hold m.mu.
+func (m *Manager) saveTrash() error {
+	entries := make([]storage.TrashEntry, 0, len(m.trash))
+	for _, e := range m.trash {
+		entry := storage.TrashEntry{
+			ID:        e.ID,
+			DeletedAt: e.DeletedAt,
+			Repo:      toRecord(e.Repo),
+		}
+		if !e.ExpiresAt.IsZero() {
+			entry.ExpiresAt = storage.TimePtr(e.ExpiresAt)
+		}
+		entries = append(entries, entry)
+	}
+	if err := os.MkdirAll(m.trashDir(), 0755); err != nil {
+		return err
+	}
+	return storage.SaveTrash(filepath.Join(m.trashDir(), "trash.json"), entries)
+}
+
+// LoadTrash loads the trash index, skipping entries whose directory is gone
+func (m *Manager) LoadTrash() error {
+	entries, err := storage.LoadTrash(filepath.Join(m.trashDir(), "trash.json"))
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.trash = make([]*TrashEntry, 0, len(entries))
+	for _, e := range entries {
+		// IDs are plain directory names, anything else was not written by us
+		if e.ID == "" || filepath.Base(e.ID) != e.ID || strings.HasPrefix(e.ID, ".") {
+			continue
+		}
+		if _, err := os.Stat(m.trashPath(e.ID)); err != nil {
+			continue
+		}
+		if ValidateName(e.Repo.Name) != nil {
+			continue
+		}
+		m.trash = append(m.trash, &TrashEntry{
+			ID:        e.ID,
+			Repo:      fromRecord(e.Repo),
+			DeletedAt: e.DeletedAt,
+			ExpiresAt: storage.TimeValue(e.ExpiresAt),
+		})
+	}
+	return nil
+}
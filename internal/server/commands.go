@@ -0,0 +1,234 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"go.uber.org/zap"
+
+	"github.com/touken928/gitlite/internal/audit"
+	"github.com/touken928/gitlite/internal/auth"
+	"github.com/touken928/gitlite/internal/i18n"
+	"github.com/touken928/gitlite/internal/logging"
+	"github.com/touken928/gitlite/internal/repo"
+
+	"github.com/gliderlabs/ssh"
+)
+
+// userCommands lists the non-git SSH commands available to users
+var userCommands = map[string]bool{"fork": true, "lang": true, "perms": true}
+
+// isUserCommand reports whether rawCmd is one of the userCommands
+func isUserCommand(rawCmd string) bool {
+	fields := strings.Fields(rawCmd)
+	return len(fields) > 0 && userCommands[fields[0]]
+}
+
+// handleUserCommand runs a non-git SSH command such as "fork". It reports
+// false when rawCmd is not one of these commands and should be parsed as git.
+func (s *Server) handleUserCommand(sess ssh.Session, msg i18n.Messages, user *auth.User, userType auth.UserType, rawCmd string) bool {
+	args := strings.Fields(rawCmd)
+	if len(args) == 0 {
+		return false
+	}
+
+	switch args[0] {
+	case "fork":
+		s.handleFork(sess, msg, user, userType, args[1:])
+	case "perms":
+		s.handlePerms(sess, msg, user, userType, args[1:])
+	case "lang":
+		s.handleUserLang(sess, msg, user, userType, args[1:])
+	default:
+		return false
+	}
+	return true
+}
+
+// handleFork handles "fork <repo> [<user>/<name>]", which forks a readable
+// repository into the user's namespace with the user as owner
+func (s *Server) handleFork(sess ssh.Session, msg i18n.Messages, user *auth.User, userType auth.UserType, args []string) {
+	if userType != auth.UserTypeNormal || user == nil {
+		io.WriteString(sess.Stderr(), msg.ForkNeedsAccount+"\r\n")
+		sess.Exit(1)
+		return
+	}
+	if len(args) < 1 || len(args) > 2 {
+		io.WriteString(sess.Stderr(), msg.ForkUsage+"\r\n")
+		sess.Exit(1)
+		return
+	}
+
+	src := trimRepoArg(args[0])
+	if target, ok := s.repoMgr.ResolveAlias(src); ok {
+		src = target
+	}
+	if !s.repoMgr.CheckPermission(src, user.Name, false) {
+		io.WriteString(sess.Stderr(), msg.GitAccessDenied+"\r\n")
+		sess.Exit(1)
+		return
+	}
+
+	dst := user.Name + "/" + path.Base(src)
+	if len(args) == 2 {
+		dst = trimRepoArg(args[1])
+	}
+	if !strings.HasPrefix(dst, user.Name+"/") {
+		io.WriteString(sess.Stderr(), fmt.Sprintf(msg.ForkOutsideNamespace+"\r\n", user.Name))
+		sess.Exit(1)
+		return
+	}
+
+	if err := s.svc.ForkRepo(src, dst, user.Name); err != nil {
+		io.WriteString(sess.Stderr(), fmt.Sprintf(msg.GitError+"\r\n", err))
+		sess.Exit(1)
+		return
+	}
+	if err := s.repoMgr.SaveToFile(filepath.Join(s.dataPath, "repos.json")); err != nil {
+		logging.Get().Error("Failed to save repo permission data", zap.Error(err))
+	}
+	logging.Get().Info("Repository forked", zap.String("src", src), zap.String("dst", dst),
+		zap.String("user", user.Name))
+	io.WriteString(sess, fmt.Sprintf(msg.Forked+"\r\n", src, dst))
+}
+
+// handlePerms handles "perms <repo> [list]", "perms <repo> add <user> <r|rw>"
+// and "perms <repo> del <user>", which let maintainers of a repository
+// manage its read and write grants
+func (s *Server) handlePerms(sess ssh.Session, msg i18n.Messages, user *auth.User, userType auth.UserType, args []string) {
+	if userType != auth.UserTypeNormal || user == nil {
+		io.WriteString(sess.Stderr(), msg.PermsNeedsAccount+"\r\n")
+		sess.Exit(1)
+		return
+	}
+	if len(args) == 0 {
+		io.WriteString(sess.Stderr(), msg.PermsUsage+"\r\n")
+		sess.Exit(1)
+		return
+	}
+
+	name := trimRepoArg(args[0])
+	if target, ok := s.repoMgr.ResolveAlias(name); ok {
+		name = target
+	}
+	if s.repoMgr.Permission(name, user.Name) < repo.PermMaintain {
+		io.WriteString(sess.Stderr(), msg.PermsNeedMaintain+"\r\n")
+		sess.Exit(1)
+		return
+	}
+
+	sub := "list"
+	if len(args) > 1 {
+		sub = args[1]
+	}
+	var err error
+	switch {
+	case sub == "list" && len(args) <= 2:
+		s.listPerms(sess, msg, name)
+		return
+	case sub == "add" && len(args) == 4:
+		perm, ok := repo.ParsePermission(args[3])
+		if !ok || perm > repo.PermWrite {
+			io.WriteString(sess.Stderr(), msg.PermsInvalid+"\r\n")
+			sess.Exit(1)
+			return
+		}
+		err = s.svc.DelegateGrant(name, user.Name, args[2], perm)
+	case sub == "del" && len(args) == 3:
+		err = s.svc.DelegateRevoke(name, user.Name, args[2])
+	default:
+		io.WriteString(sess.Stderr(), msg.PermsUsage+"\r\n")
+		sess.Exit(1)
+		return
+	}
+
+	command := strings.Join(append([]string{"perms", name}, args[1:]...), " ")
+	remote, _, _ := net.SplitHostPort(sess.RemoteAddr().String())
+	entry := audit.Entry{Actor: "user:" + user.Name, Via: "ssh", Remote: remote, Command: command, OK: err == nil}
+	if auditErr := audit.Record(s.dataPath, entry); auditErr != nil {
+		logging.Get().Warn("Failed to write audit log", zap.Error(auditErr))
+	}
+	if err != nil {
+		io.WriteString(sess.Stderr(), fmt.Sprintf(msg.GitError+"\r\n", err))
+		sess.Exit(1)
+		return
+	}
+
+	if err := s.repoMgr.SaveToFile(filepath.Join(s.dataPath, "repos.json")); err != nil {
+		logging.Get().Error("Failed to save repo permission data", zap.Error(err))
+	}
+	logging.Get().Info("Repository grant changed by maintainer", zap.String("repo", name),
+		zap.String("maintainer", user.Name), zap.String("command", command))
+	if sub == "add" {
+		io.WriteString(sess, fmt.Sprintf(msg.PermsGranted+"\r\n", args[2], args[3], name))
+	} else {
+		io.WriteString(sess, fmt.Sprintf(msg.PermsRevoked+"\r\n", args[2], name))
+	}
+}
+
+// handleUserLang handles "lang [zh|en|auto]", which saves the language of
+// the messages a user gets from the server. "auto" follows the SSH locale.
+func (s *Server) handleUserLang(sess ssh.Session, msg i18n.Messages, user *auth.User, userType auth.UserType, args []string) {
+	if userType != auth.UserTypeNormal || user == nil {
+		io.WriteString(sess.Stderr(), msg.UserLangNeedsAccount+"\r\n")
+		sess.Exit(1)
+		return
+	}
+	if len(args) == 0 {
+		io.WriteString(sess, msg.CurrentLang+s.sessionLang(sess, user, userType)+"\r\n")
+		return
+	}
+
+	lang := args[0]
+	if len(args) != 1 || (lang != "auto" && !i18n.Supported(lang)) {
+		io.WriteString(sess.Stderr(), msg.LangUsage+" ("+strings.Join(i18n.Languages(), ", ")+")\r\n")
+		sess.Exit(1)
+		return
+	}
+	if lang == "auto" {
+		lang = ""
+	}
+	if err := s.authMgr.SetUserLang(user.Name, lang); err != nil {
+		io.WriteString(sess.Stderr(), fmt.Sprintf(msg.GitError+"\r\n", err))
+		sess.Exit(1)
+		return
+	}
+	if err := s.authMgr.SaveToFile(filepath.Join(s.dataPath, "users.json")); err != nil {
+		logging.Get().Error("Failed to save user data", zap.Error(err))
+	}
+
+	if lang == "" {
+		io.WriteString(sess, i18n.GetMessages(i18n.FromEnv(sess.Environ())).LangAuto+"\r\n")
+		return
+	}
+	io.WriteString(sess, i18n.GetMessages(lang).LangSwitched+"\r\n")
+}
+
+// listPerms writes the grants of a repository, one "user perm" line each
+func (s *Server) listPerms(sess ssh.Session, msg i18n.Messages, name string) {
+	r := s.repoMgr.Get(name)
+	if r == nil {
+		io.WriteString(sess.Stderr(), msg.GitRepoNotFound+"\r\n")
+		sess.Exit(1)
+		return
+	}
+	users := make([]string, 0, len(r.Users))
+	for u := range r.Users {
+		users = append(users, u)
+	}
+	sort.Strings(users)
+	for _, u := range users {
+		io.WriteString(sess, fmt.Sprintf("%s %s\r\n", u, s.repoMgr.Permission(name, u)))
+	}
+}
+
+// trimRepoArg turns a repository argument like "/team/app.git" into a repository name
+func trimRepoArg(arg string) string {
+	arg = strings.Trim(arg, "'\"")
+	return strings.TrimSuffix(strings.TrimPrefix(arg, "/"), ".git")
+}
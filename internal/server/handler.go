@@ -1,22 +1,41 @@
 package server
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"os"
+	"strings"
 
 	"go.uber.org/zap"
 
+	"github.com/touken928/gitlite/internal/admin"
 	"github.com/touken928/gitlite/internal/auth"
 	"github.com/touken928/gitlite/internal/git"
+	"github.com/touken928/gitlite/internal/i18n"
+	"github.com/touken928/gitlite/internal/lfs"
 	"github.com/touken928/gitlite/internal/logging"
+	"github.com/touken928/gitlite/internal/repo"
 
 	"github.com/gliderlabs/ssh"
+	gossh "golang.org/x/crypto/ssh"
 )
 
 // handlePublicKey validates SSH public keys for authentication
 func (s *Server) handlePublicKey(ctx ssh.Context, key ssh.PublicKey) bool {
-	user, userType := s.authMgr.Authenticate(key)
+	var user *auth.User
+	var userType auth.UserType
+	if cert, ok := key.(*gossh.Certificate); ok {
+		var err error
+		user, userType, err = s.authMgr.AuthenticateCertificate(cert, ctx.RemoteAddr())
+		if err != nil {
+			logging.Get().Warn("Certificate rejected",
+				zap.String("key_id", cert.KeyId), zap.Uint64("serial", cert.Serial), zap.Error(err))
+		}
+	} else {
+		user, userType = s.authMgr.Authenticate(key)
+	}
 
 	ctx.SetValue("user", user)
 	ctx.SetValue("userType", userType)
@@ -25,39 +44,92 @@ func (s *Server) handlePublicKey(ctx ssh.Context, key ssh.PublicKey) bool {
 	return true
 }
 
+// sessionLang returns the language of a session: the saved preference of
+// the admin or user, otherwise the locale sent by the SSH client
+func (s *Server) sessionLang(sess ssh.Session, user *auth.User, userType auth.UserType) string {
+	switch {
+	case userType == auth.UserTypeAdmin && user != nil:
+		if a := s.authMgr.GetAdmin(user.Name); a != nil && a.Lang != "" {
+			return a.Lang
+		}
+	case userType == auth.UserTypeNormal && user != nil && user.Lang != "":
+		return user.Lang
+	}
+	return i18n.FromEnv(sess.Environ())
+}
+
+// hasAdminRole reports whether a normal user also carries the admin role
+func hasAdminRole(user *auth.User, userType auth.UserType) bool {
+	return userType == auth.UserTypeNormal && user != nil && user.HasRole(auth.RoleAdmin)
+}
+
 // handleSession processes incoming SSH sessions for git or admin operations
 func (s *Server) handleSession(sess ssh.Session) {
 	user, _ := sess.Context().Value("user").(*auth.User)
 	userType, _ := sess.Context().Value("userType").(auth.UserType)
 
-	rawCmd := sess.RawCommand()
+	// Remember when and from where a user key was used
+	if userType == auth.UserTypeNormal && user != nil {
+		if key := sess.PublicKey(); key != nil {
+			if _, isCert := key.(*gossh.Certificate); !isCert {
+				host, _, _ := net.SplitHostPort(sess.RemoteAddr().String())
+				s.authMgr.RecordKeyUse(user.Name, gossh.FingerprintSHA256(key), host)
+			}
+		}
+	}
 
-	// Empty command triggers admin TUI login
-	if rawCmd == "" {
-		if userType != auth.UserTypeAdmin {
-			io.WriteString(sess, "Access denied: admin only\r\n")
-			sess.Exit(1)
-			return
+	rawCmd := sess.RawCommand()
+	lang := s.sessionLang(sess, user, userType)
+	msg := i18n.GetMessages(lang)
+
+	// Admins get the TUI on a terminal, run a single command given on the
+	// command line, or run a batch of commands read from stdin. Users with
+	// the admin role do the same for everything but git and user commands.
+	if userType == auth.UserTypeAdmin || (hasAdminRole(user, userType) && !git.IsCommand(rawCmd) && !isUserCommand(rawCmd)) {
+		tui := admin.New(s.authMgr, s.repoMgr, s.tokens, s.dataPath)
+		tui.SetActor(user.Name)
+		tui.SetLang(lang)
+		logging.Get().Info("Admin session",
+			zap.String("admin", user.Name), zap.String("remote", sess.RemoteAddr().String()))
+		_, _, isPty := sess.Pty()
+		switch {
+		case rawCmd != "":
+			sess.Exit(tui.Exec(sess, sess.Command()))
+		case isPty:
+			tui.Run(sess)
+		default:
+			sess.Exit(tui.RunBatch(sess))
 		}
-		s.tui.Run(sess)
 		return
 	}
 
-	// Admin users cannot perform git operations
-	if userType == auth.UserTypeAdmin {
-		io.WriteString(sess, "Access denied: admins cannot perform Git operations\r\n")
+	// Empty command is only accepted from admins
+	if rawCmd == "" {
+		io.WriteString(sess, msg.GitAdminOnly+"\r\n")
 		sess.Exit(1)
 		return
 	}
 
+	// Commands other than git, such as fork
+	if s.handleUserCommand(sess, msg, user, userType, rawCmd) {
+		return
+	}
+
 	// Parse and execute git command
 	gitCmd, err := git.ParseCommand(rawCmd)
 	if err != nil {
-		io.WriteString(sess, fmt.Sprintf("Error: %v\r\n", err))
+		io.WriteString(sess, fmt.Sprintf(msg.GitError+"\r\n", err))
 		sess.Exit(1)
 		return
 	}
 
+	// Follow the former name of a renamed repository
+	renamedFrom := ""
+	if target, ok := s.repoMgr.ResolveAlias(strings.TrimSuffix(gitCmd.RepoPath, ".git")); ok {
+		renamedFrom = gitCmd.RepoPath
+		gitCmd.RepoPath = target + ".git"
+	}
+
 	userName := ""
 	if user != nil {
 		userName = user.Name
@@ -65,21 +137,79 @@ func (s *Server) handleSession(sess ssh.Session) {
 
 	// Check user permissions
 	if !s.repoMgr.CheckPermission(gitCmd.RepoPath, userName, gitCmd.IsWrite) {
-		io.WriteString(sess, "Access denied: insufficient permissions\r\n")
+		// Tell readers why their push fails instead of a generic denial
+		if gitCmd.IsWrite && s.repoMgr.CheckPermission(gitCmd.RepoPath, userName, false) {
+			if r := s.repoMgr.Get(strings.TrimSuffix(gitCmd.RepoPath, ".git")); r != nil && r.Archived {
+				io.WriteString(sess.Stderr(), msg.GitRepoArchived+"\r\n")
+				sess.Exit(1)
+				return
+			}
+		}
+		io.WriteString(sess, msg.GitAccessDenied+"\r\n")
 		sess.Exit(1)
 		return
 	}
 
-	repoFullPath := s.repoMgr.GetRepoPath(gitCmd.RepoPath)
+	// Only reveal the new name to users allowed to access the repository
+	if renamedFrom != "" {
+		io.WriteString(sess.Stderr(), fmt.Sprintf(msg.GitRepoRenamed+"\r\n", renamedFrom, gitCmd.RepoPath))
+	}
+
+	repoFullPath, err := s.repoMgr.GetRepoPath(gitCmd.RepoPath)
+	if err != nil {
+		logging.Get().Warn("Rejected repository path", zap.String("repo", gitCmd.RepoPath), zap.Error(err))
+		io.WriteString(sess, msg.GitRepoNotFound+"\r\n")
+		sess.Exit(1)
+		return
+	}
 	if _, err := os.Stat(repoFullPath); os.IsNotExist(err) {
-		io.WriteString(sess, "Error: repository does not exist\r\n")
+		io.WriteString(sess, msg.GitRepoNotFound+"\r\n")
 		sess.Exit(1)
 		return
 	}
 
-	if err := git.Execute(sess, gitCmd, repoFullPath); err != nil {
-		logging.Get().Error("Git execution error", zap.Error(err))
+	// Apply repository and user quotas to pushes
+	var limits git.Limits
+	if gitCmd.IsWrite {
+		limits, err = s.pushLimits(gitCmd.RepoPath, user)
+		if err != nil {
+			io.WriteString(sess.Stderr(), fmt.Sprintf(msg.GitPushRejected+"\r\n", err))
+			sess.Exit(1)
+			return
+		}
+	}
+
+	// Writes are fenced off while a backup takes its snapshot, and the
+	// repository is not renamed or deleted while they run
+	if gitCmd.IsWrite {
+		repoName := strings.TrimSuffix(gitCmd.RepoPath, ".git")
+		s.repoMgr.BeginWrite(repoName)
+		defer s.repoMgr.EndWrite(repoName)
+	}
+
+	// LFS transfers are served in-process instead of by a git binary
+	if gitCmd.Cmd == "git-lfs-transfer" {
+		if err := lfs.Serve(sess, repoFullPath, gitCmd.Operation, limits.MaxInputSize); err != nil {
+			logging.Get().Error("LFS transfer error", zap.Error(err))
+			sess.Exit(1)
+			return
+		}
+		if gitCmd.IsWrite {
+			s.repoMgr.RecordPush(strings.TrimSuffix(gitCmd.RepoPath, ".git"))
+		}
+		return
+	}
+
+	if err := git.Execute(sess, gitCmd, repoFullPath, limits); err != nil {
+		if errors.Is(err, git.ErrInputTooLarge) {
+			io.WriteString(sess.Stderr(), fmt.Sprintf(msg.GitPushLimit+"\r\n", repo.FormatSize(limits.MaxInputSize)))
+		} else {
+			logging.Get().Error("Git execution error", zap.Error(err))
+		}
 		sess.Exit(1)
 		return
 	}
+	if gitCmd.IsWrite {
+		s.repoMgr.RecordPush(strings.TrimSuffix(gitCmd.RepoPath, ".git"))
+	}
 }
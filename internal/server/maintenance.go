@@ -0,0 +1,108 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+
+	"github.com/touken928/gitlite/internal/config"
+	"github.com/touken928/gitlite/internal/logging"
+	"github.com/touken928/gitlite/internal/repo"
+)
+
+// maxPacks is the number of pack files that makes a repository due for gc
+const maxPacks = 50
+
+// startMaintenance runs scheduled repository maintenance in the background until Stop
+func (s *Server) startMaintenance(cfg *config.Config) {
+	if cfg.MaintenanceInterval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(cfg.MaintenanceInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.runMaintenance(cfg.MaintenanceLooseObjects, cfg.MaintenanceMaxLoad)
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// runMaintenance runs gc on every repository that is due, stopping early
+// while the system load is above maxLoad
+func (s *Server) runMaintenance(looseObjects int, maxLoad float64) {
+	ran := 0
+	for _, r := range s.repoMgr.List() {
+		select {
+		case <-s.stop:
+			return
+		default:
+		}
+		if maxLoad > 0 {
+			if load, ok := loadAverage(); ok && load > maxLoad {
+				logging.Get().Info("Postponing repository maintenance, system is busy",
+					zap.Float64("load", load), zap.Float64("max_load", maxLoad))
+				break
+			}
+		}
+		if !s.maintenanceDue(r, looseObjects) {
+			continue
+		}
+
+		run, err := s.repoMgr.Maintain(r.Name, repo.TaskGC, nil)
+		if err != nil {
+			logging.Get().Warn("Repository maintenance skipped", zap.String("repo", r.Name), zap.Error(err))
+			continue
+		}
+		ran++
+		if run.OK {
+			logging.Get().Info("Repository maintenance done", zap.String("repo", r.Name),
+				zap.Duration("duration", run.Duration))
+		} else {
+			logging.Get().Warn("Repository maintenance failed", zap.String("repo", r.Name),
+				zap.String("message", run.Message))
+		}
+	}
+
+	if ran > 0 {
+		if err := s.repoMgr.SaveToFile(filepath.Join(s.dataPath, "repos.json")); err != nil {
+			logging.Get().Error("Failed to save repo permission data", zap.Error(err))
+		}
+	}
+}
+
+// maintenanceDue reports whether a repository has too many loose objects or
+// packs, or received pushes since its last gc
+func (s *Server) maintenanceDue(r *repo.Repository, looseObjects int) bool {
+	last := r.Maintenance[repo.TaskGC]
+	if !r.LastPush.IsZero() && (last == nil || r.LastPush.After(last.StartedAt)) {
+		return true
+	}
+	stats, err := s.repoMgr.ObjectStats(r.Name)
+	if err != nil {
+		return false
+	}
+	return (looseObjects > 0 && stats.Loose >= int64(looseObjects)) || stats.Packs >= maxPacks
+}
+
+// loadAverage returns the one minute load average, where the system reports it
+func loadAverage() (float64, bool) {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return 0, false
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) == 0 {
+		return 0, false
+	}
+	load, err := strconv.ParseFloat(fields[0], 64)
+	return load, err == nil
+}
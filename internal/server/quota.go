@@ -0,0 +1,49 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/touken928/gitlite/internal/auth"
+	"github.com/touken928/gitlite/internal/git"
+	"github.com/touken928/gitlite/internal/repo"
+)
+
+// pushLimits computes how much a push by the given user may add to a repository.
+// An error is returned when a quota is already used up and the push must be refused.
+func (s *Server) pushLimits(repoName string, user *auth.User) (git.Limits, error) {
+	r := s.repoMgr.Get(repoName)
+	if r == nil {
+		return git.Limits{}, fmt.Errorf("repository does not exist")
+	}
+	limits := git.Limits{MaxBlobSize: r.MaxBlobSize}
+
+	if r.Quota > 0 {
+		size, err := s.repoMgr.Size(r.Name)
+		if err != nil {
+			return limits, err
+		}
+		left := r.Quota - size
+		if left <= 0 {
+			return limits, fmt.Errorf("repository quota exceeded (%s used of %s)",
+				repo.FormatSize(size), repo.FormatSize(r.Quota))
+		}
+		limits.MaxInputSize = left
+	}
+
+	if user != nil && user.Quota > 0 {
+		usage, err := s.repoMgr.UserUsage(user.Name)
+		if err != nil {
+			return limits, err
+		}
+		left := user.Quota - usage
+		if left <= 0 {
+			return limits, fmt.Errorf("user quota exceeded (%s used of %s)",
+				repo.FormatSize(usage), repo.FormatSize(user.Quota))
+		}
+		if limits.MaxInputSize == 0 || left < limits.MaxInputSize {
+			limits.MaxInputSize = left
+		}
+	}
+
+	return limits, nil
+}
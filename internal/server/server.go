@@ -1,17 +1,21 @@
 package server
 
 import (
+	"bytes"
 	"os"
 	"path/filepath"
+	"time"
 
 	"go.uber.org/zap"
 
+	"github.com/touken928/gitlite/internal/api"
 	"github.com/touken928/gitlite/internal/auth"
 	"github.com/touken928/gitlite/internal/config"
+	"github.com/touken928/gitlite/internal/i18n"
 	"github.com/touken928/gitlite/internal/logging"
 	"github.com/touken928/gitlite/internal/repo"
-
-	"github.com/touken928/gitlite/internal/admin"
+	"github.com/touken928/gitlite/internal/service"
+	"github.com/touken928/gitlite/internal/storage"
 
 	"github.com/gliderlabs/ssh"
 	gossh "golang.org/x/crypto/ssh"
@@ -24,7 +28,11 @@ type Server struct {
 	sshSrv   *ssh.Server         // SSH server instance
 	authMgr  *auth.Manager       // User authentication manager
 	repoMgr  *repo.Manager       // Repository manager
-	tui      *admin.TUI          // Admin TUI instance
+	tokens   *auth.TokenManager  // HTTP API tokens
+	svc      *service.Service    // Cross-manager operations
+	api      *api.Server         // HTTP admin API, nil when disabled
+	stop     chan struct{}       // Closed on Stop to end background tasks
+	reposErr error               // Error loading repos.json, which startup and Stop then leave as is
 }
 
 // New creates a new server instance with the given configuration
@@ -34,33 +42,77 @@ func New(cfg *config.Config) (*Server, error) {
 		dataPath: cfg.DataPath,
 		authMgr:  auth.NewManager(),
 		repoMgr:  repo.NewManager(cfg.DataPath),
+		tokens:   auth.NewTokenManager(),
+		stop:     make(chan struct{}),
 	}
-	s.tui = admin.New(s.authMgr, s.repoMgr, cfg.DataPath)
+	s.authMgr.SetDeployKeyResolver(s.repoMgr)
+	s.svc = service.New(s.authMgr, s.repoMgr)
 
 	// Ensure data directory exists
 	if err := os.MkdirAll(filepath.Join(cfg.DataPath, "repos"), 0755); err != nil {
 		return nil, err
 	}
 
+	// Claim the data directory so restore and a second server keep out
+	if err := storage.LockDataDir(cfg.DataPath); err != nil {
+		return nil, err
+	}
+
 	// Load or generate host key for SSH
 	hostKey, err := s.loadOrGenerateHostKey()
 	if err != nil {
+		storage.UnlockDataDir(cfg.DataPath)
 		return nil, err
 	}
 
-	// Load admin public key if available
-	if err := s.loadAdminKey(); err != nil {
-		logging.Get().Warn("Admin public key not found, please create "+cfg.DataPath+"/admin.pub")
+	// Load message catalogs that override or add translations
+	for _, err := range i18n.LoadCatalogs(filepath.Join(cfg.DataPath, "i18n")) {
+		logging.Get().Warn("Skipped message catalog entry", zap.Error(err))
 	}
 
+	// Load administrators, importing admin.pub when there are none
+	if err := s.loadAdmins(); err != nil {
+		logging.Get().Warn("No administrator configured, please create "+cfg.DataPath+"/admin.pub", zap.Error(err))
+	}
+
+	// Load trusted user CA keys for certificate authentication
+	if err := s.loadUserCAKeys(); err != nil && !os.IsNotExist(err) {
+		logging.Get().Warn("Failed to load user CA keys", zap.Error(err))
+	}
+	s.authMgr.SetRevocationFile(filepath.Join(cfg.DataPath, "revoked_certs"))
+
 	// Load persisted user data
 	if err := s.authMgr.LoadFromFile(filepath.Join(cfg.DataPath, "users.json")); err != nil {
 		logging.Get().Warn("Failed to load user data", zap.Error(err))
 	}
 
 	// Load persisted repository permission data
-	if err := s.repoMgr.LoadFromFile(filepath.Join(cfg.DataPath, "repos.json")); err != nil {
-		logging.Get().Warn("Failed to load repo permission data", zap.Error(err))
+	s.reposErr = s.repoMgr.LoadFromFile(filepath.Join(cfg.DataPath, "repos.json"))
+	if s.reposErr != nil {
+		logging.Get().Warn("Failed to load repo permission data", zap.Error(s.reposErr))
+	}
+
+	// Load the tokens of the HTTP admin API
+	if err := s.tokens.LoadFromFile(filepath.Join(cfg.DataPath, "tokens.json")); err != nil {
+		logging.Get().Warn("Failed to load API tokens", zap.Error(err))
+	}
+
+	// Adopt bare repositories that exist on disk but are not registered; saving
+	// them would overwrite a repos.json that failed to load
+	if s.reposErr == nil {
+		s.adoptRepositories()
+	} else {
+		logging.Get().Warn("Not adopting repositories until repos.json loads")
+	}
+
+	// Load the trash and purge repositories deleted longer ago than the retention
+	s.repoMgr.SetTrashRetention(time.Duration(cfg.TrashRetention) * 24 * time.Hour)
+	s.purgeTrash()
+
+	// Report grants left behind by deleted users
+	if grants := s.svc.DanglingGrants(); len(grants) > 0 {
+		logging.Get().Warn("Repository grants refer to deleted users, run fsck in the admin CLI",
+			zap.Int("count", len(grants)))
 	}
 
 	s.sshSrv = &ssh.Server{
@@ -68,33 +120,67 @@ func New(cfg *config.Config) (*Server, error) {
 		Handler:          s.handleSession,
 		PublicKeyHandler: s.handlePublicKey,
 		PtyCallback: func(ctx ssh.Context, pty ssh.Pty) bool {
+			user, _ := ctx.Value("user").(*auth.User)
 			userType, _ := ctx.Value("userType").(auth.UserType)
-			return userType == auth.UserTypeAdmin
+			return userType == auth.UserTypeAdmin || hasAdminRole(user, userType)
 		},
 	}
 	s.sshSrv.AddHostKey(hostKey)
 
+	if cfg.HTTPAddr != "" {
+		if s.api, err = api.New(cfg.HTTPAddr, cfg.HTTPTLSCert, cfg.HTTPTLSKey, cfg.DataPath, s.authMgr, s.repoMgr, s.tokens); err != nil {
+			storage.UnlockDataDir(cfg.DataPath)
+			return nil, err
+		}
+	}
+
+	s.startMaintenance(cfg)
+	if cfg.TrashRetention > 0 {
+		s.startTrashPurge()
+	}
+
 	return s, nil
 }
 
-// Start begins listening for SSH connections
+// Start begins listening for SSH connections and, when enabled, HTTP API requests
 func (s *Server) Start() error {
+	if s.api != nil {
+		go func() {
+			if err := s.api.Start(); err != nil {
+				logging.Get().Error("HTTP API stopped", zap.Error(err))
+			}
+		}()
+		logging.Get().Info("HTTP admin API started", zap.String("addr", s.api.Addr()))
+	}
 	return s.sshSrv.ListenAndServe()
 }
 
 // Stop gracefully shuts down the server and persists data
 func (s *Server) Stop() {
+	close(s.stop)
+	if s.api != nil {
+		s.api.Stop()
+	}
+
 	// Persist user data
 	if err := s.authMgr.SaveToFile(filepath.Join(s.dataPath, "users.json")); err != nil {
 		logging.Get().Error("Failed to save user data", zap.Error(err))
 	}
 
-	// Persist repository permission data
-	if err := s.repoMgr.SaveToFile(filepath.Join(s.dataPath, "repos.json")); err != nil {
-		logging.Get().Error("Failed to save repo permission data", zap.Error(err))
+	// Persist repository permission data, unless the file could not be read
+	if s.reposErr == nil {
+		if err := s.repoMgr.SaveToFile(filepath.Join(s.dataPath, "repos.json")); err != nil {
+			logging.Get().Error("Failed to save repo permission data", zap.Error(err))
+		}
+	}
+
+	// Persist API tokens, which records when they were last used
+	if err := s.tokens.SaveToFile(filepath.Join(s.dataPath, "tokens.json")); err != nil {
+		logging.Get().Error("Failed to save API tokens", zap.Error(err))
 	}
 
 	s.sshSrv.Close()
+	storage.UnlockDataDir(s.dataPath)
 }
 
 // loadOrGenerateHostKey loads an existing host key or generates a new one
@@ -117,20 +203,124 @@ func (s *Server) loadOrGenerateHostKey() (ssh.Signer, error) {
 	return gossh.ParsePrivateKey(keyData)
 }
 
-// loadAdminKey loads the administrator's public key from file
-func (s *Server) loadAdminKey() error {
-	keyPath := filepath.Join(s.dataPath, "admin.pub")
-	keyData, err := os.ReadFile(keyPath)
+// loadAdmins loads the administrators from admins.json. Without any, the
+// keys in admin.pub become the administrator "admin", so setups with a
+// single admin key keep working.
+func (s *Server) loadAdmins() error {
+	adminsPath := filepath.Join(s.dataPath, "admins.json")
+	if err := s.authMgr.LoadAdminsFromFile(adminsPath); err != nil {
+		return err
+	}
+	if admins := s.authMgr.ListAdmins(); len(admins) > 0 {
+		logging.Get().Info("Administrators loaded", zap.Int("count", len(admins)))
+		return nil
+	}
+
+	keyData, err := os.ReadFile(filepath.Join(s.dataPath, "admin.pub"))
 	if err != nil {
 		return err
 	}
+	for len(bytes.TrimSpace(keyData)) > 0 {
+		pubKey, comment, _, rest, err := gossh.ParseAuthorizedKey(keyData)
+		if err != nil {
+			return err
+		}
+		key := &auth.Key{PublicKey: pubKey, Comment: comment, AddedAt: time.Now(), AddedBy: "admin.pub"}
+		if err := s.authMgr.AddAdmin("admin", key); err != nil && err != auth.ErrKeyExists {
+			return err
+		}
+		keyData = rest
+	}
 
-	pubKey, _, _, _, err := gossh.ParseAuthorizedKey(keyData)
+	if err := s.authMgr.SaveAdminsToFile(adminsPath); err != nil {
+		return err
+	}
+	logging.Get().Info("Imported admin.pub as administrator admin")
+	return nil
+}
+
+// loadUserCAKeys loads the CA keys trusted to sign user certificates
+func (s *Server) loadUserCAKeys() error {
+	keyData, err := os.ReadFile(filepath.Join(s.dataPath, "user_ca.pub"))
 	if err != nil {
 		return err
 	}
 
-	s.authMgr.SetAdminKey(pubKey)
-	logging.Get().Info("Admin public key loaded")
+	var keys []gossh.PublicKey
+	for len(bytes.TrimSpace(keyData)) > 0 {
+		pubKey, _, _, rest, err := gossh.ParseAuthorizedKey(keyData)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, pubKey)
+		keyData = rest
+	}
+
+	s.authMgr.SetUserCAKeys(keys)
+	logging.Get().Info("User CA keys loaded", zap.Int("count", len(keys)))
 	return nil
 }
+
+// purgeTrash loads the trash index and permanently deletes expired repositories
+func (s *Server) purgeTrash() {
+	if err := s.repoMgr.LoadTrash(); err != nil {
+		logging.Get().Warn("Failed to load trash", zap.Error(err))
+		return
+	}
+	s.purgeExpiredTrash()
+}
+
+// trashPurgeInterval is how often expired repositories are purged from the trash
+const trashPurgeInterval = time.Hour
+
+// startTrashPurge purges expired repositories from the trash every
+// trashPurgeInterval until Stop, so the retention holds on long running servers
+func (s *Server) startTrashPurge() {
+	go func() {
+		ticker := time.NewTicker(trashPurgeInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.purgeExpiredTrash()
+			case <-s.stop:
+				return
+			}
+		}
+	}()
+}
+
+// purgeExpiredTrash permanently deletes repositories whose retention has passed
+func (s *Server) purgeExpiredTrash() {
+	purged, err := s.repoMgr.PurgeExpired(time.Now())
+	if err != nil {
+		logging.Get().Warn("Failed to purge trash", zap.Error(err))
+	}
+	for _, e := range purged {
+		logging.Get().Info("Purged deleted repository", zap.String("repo", e.Repo.Name),
+			zap.Time("deleted_at", e.DeletedAt))
+	}
+}
+
+// adoptRepositories registers bare repositories found on disk with empty permissions
+func (s *Server) adoptRepositories() {
+	names, err := s.repoMgr.Scan()
+	if err != nil {
+		logging.Get().Warn("Failed to scan for repositories", zap.Error(err))
+		return
+	}
+	if len(names) == 0 {
+		return
+	}
+
+	for _, name := range names {
+		if err := s.repoMgr.Import(name); err != nil {
+			logging.Get().Warn("Failed to adopt repository", zap.String("repo", name), zap.Error(err))
+			continue
+		}
+		logging.Get().Info("Adopted existing repository", zap.String("repo", name))
+	}
+	if err := s.repoMgr.SaveToFile(filepath.Join(s.dataPath, "repos.json")); err != nil {
+		logging.Get().Error("Failed to save repo permission data", zap.Error(err))
+	}
+}
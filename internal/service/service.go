@@ -0,0 +1,356 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/touken928/gitlite/internal/auth"
+	"github.com/touken928/gitlite/internal/repo"
+
+	gossh "golang.org/x/crypto/ssh"
+)
+
+// GuestUser is the built-in virtual user for anonymous read access
+const GuestUser = "guest"
+
+// Errors returned when an operation is refused
+var (
+	ErrUserHasGrants = errors.New("user still has repository grants")         // User to delete still has grants
+	ErrGuestReserved = errors.New("guest is a reserved user name")            // Guest cannot be created or deleted
+	ErrGuestReadOnly = errors.New("guest user can only have read permission") // Guest cannot get write access
+	ErrKeyInUse      = errors.New("key is already in use")                    // Key belongs to the admin, a user or a deploy key
+	ErrNotMaintainer = errors.New("maintain permission required")             // User may not manage the grants of the repository
+	ErrMaintainGrant = errors.New("maintain grants are managed by admins")    // Maintainers cannot grant or revoke maintain access
+)
+
+// Grant is a single repository permission entry
+type Grant struct {
+	Repo string          // Repository name
+	User string          // Username
+	Perm repo.Permission // Granted permission
+}
+
+// Service coordinates the auth and repo managers so that operations
+// spanning both keep users and repository grants consistent
+type Service struct {
+	authMgr auth.AuthManager // User authentication manager interface
+	repoMgr repo.RepoManager // Repository manager interface
+}
+
+// New creates a new Service instance
+func New(authMgr auth.AuthManager, repoMgr repo.RepoManager) *Service {
+	return &Service{
+		authMgr: authMgr,
+		repoMgr: repoMgr,
+	}
+}
+
+// GrantUser gives a live user, or guest with read access, a permission on a repository
+func (s *Service) GrantUser(repoName, userName string, perm repo.Permission) error {
+	if userName == GuestUser {
+		if perm != repo.PermRead {
+			return ErrGuestReadOnly
+		}
+	} else if s.authMgr.GetUser(userName) == nil {
+		return &auth.UserNotFoundError{Name: userName}
+	}
+	return s.repoMgr.AddUser(repoName, userName, perm)
+}
+
+// DelegateGrant lets a maintainer of a repository give a user, or guest,
+// read or write access to it. Maintain grants are left to the admins.
+func (s *Service) DelegateGrant(repoName, maintainer, userName string, perm repo.Permission) error {
+	if err := s.checkDelegation(repoName, maintainer, userName); err != nil {
+		return err
+	}
+	if perm > repo.PermWrite {
+		return ErrMaintainGrant
+	}
+	return s.GrantUser(repoName, userName, perm)
+}
+
+// DelegateRevoke lets a maintainer of a repository revoke the read or write
+// access of a user
+func (s *Service) DelegateRevoke(repoName, maintainer, userName string) error {
+	if err := s.checkDelegation(repoName, maintainer, userName); err != nil {
+		return err
+	}
+	return s.repoMgr.RemoveUser(repoName, userName)
+}
+
+// checkDelegation verifies that maintainer may change the grant of userName.
+// Unknown repositories are reported like missing permissions, so that
+// users cannot probe for repository names.
+func (s *Service) checkDelegation(repoName, maintainer, userName string) error {
+	if s.repoMgr.Permission(repoName, maintainer) < repo.PermMaintain {
+		return ErrNotMaintainer
+	}
+	if s.repoMgr.Permission(repoName, userName) >= repo.PermMaintain {
+		return ErrMaintainGrant
+	}
+	return nil
+}
+
+// CreateUser creates a user, refusing the name of the guest user
+func (s *Service) CreateUser(userName string) error {
+	if userName == GuestUser {
+		return ErrGuestReserved
+	}
+	return s.authMgr.CreateUser(userName)
+}
+
+// AddUserKey adds a key to a user unless it is a deploy key or an administrator's key
+func (s *Service) AddUserKey(userName string, key *auth.Key) error {
+	if _, isDeployKey := s.repoMgr.ResolveDeployKey(key.PublicKey); isDeployKey {
+		return ErrKeyInUse
+	}
+	if _, userType := s.authMgr.Authenticate(key.PublicKey); userType == auth.UserTypeAdmin {
+		return ErrKeyInUse
+	}
+	return s.authMgr.AddKeyToUser(userName, key)
+}
+
+// AddAdminKey adds a key to an administrator, creating the administrator if
+// needed, unless the key belongs to a user, a repository or another administrator
+func (s *Service) AddAdminKey(adminName string, key *auth.Key) error {
+	owner, userType := s.authMgr.Authenticate(key.PublicKey)
+	if userType != auth.UserTypeUnknown && (userType != auth.UserTypeAdmin || owner.Name != adminName) {
+		return ErrKeyInUse
+	}
+	return s.authMgr.AddAdmin(adminName, key)
+}
+
+// AddDeployKey attaches a key to a repository unless it belongs to the admin or a user
+func (s *Service) AddDeployKey(repoName string, key gossh.PublicKey, perm repo.Permission) error {
+	if _, userType := s.authMgr.Authenticate(key); userType == auth.UserTypeAdmin || userType == auth.UserTypeNormal {
+		return ErrKeyInUse
+	}
+	return s.repoMgr.AddDeployKey(repoName, key, perm)
+}
+
+// UserGrants returns all repository grants of a user
+func (s *Service) UserGrants(userName string) []Grant {
+	return s.collectGrants(func(u string) bool { return u == userName })
+}
+
+// UserDeletion lists what deleting a user changes besides the account
+type UserDeletion struct {
+	Grants []Grant  // Repository grants revoked with the user
+	Owned  []string // Repositories whose owner is cleared, sorted
+}
+
+// PlanDeleteUser returns what DeleteUser would change. Unless cascade is
+// set, a user with repository grants cannot be deleted and
+// ErrUserHasGrants is returned along with the plan.
+func (s *Service) PlanDeleteUser(userName string, cascade bool) (*UserDeletion, error) {
+	if userName == GuestUser {
+		return nil, ErrGuestReserved
+	}
+	if s.authMgr.GetUser(userName) == nil {
+		return nil, &auth.UserNotFoundError{Name: userName}
+	}
+
+	plan := &UserDeletion{Grants: s.UserGrants(userName)}
+	// Ownership is not an access grant, it is simply cleared
+	for _, r := range s.repoMgr.List() {
+		if r.Owner == userName {
+			plan.Owned = append(plan.Owned, r.Name)
+		}
+	}
+	sort.Strings(plan.Owned)
+	if len(plan.Grants) > 0 && !cascade {
+		return plan, ErrUserHasGrants
+	}
+	return plan, nil
+}
+
+// DeleteUser removes a user as planned by PlanDeleteUser. A user with
+// repository grants is only deleted with cascade; otherwise
+// ErrUserHasGrants is returned along with the grants. With cascade the
+// grants are revoked after the user is deleted and returned, also with an
+// error, in which case the grants left over are dangling grants.
+func (s *Service) DeleteUser(userName string, cascade bool) ([]Grant, error) {
+	plan, err := s.PlanDeleteUser(userName, cascade)
+	if err != nil {
+		if plan != nil {
+			return plan.Grants, err
+		}
+		return nil, err
+	}
+	if err := s.authMgr.DeleteUser(userName); err != nil {
+		return nil, err
+	}
+
+	revoked := make([]Grant, 0, len(plan.Grants))
+	for _, g := range plan.Grants {
+		if err := s.repoMgr.RemoveUser(g.Repo, g.User); err != nil && !isNotFound(err) {
+			return revoked, err
+		}
+		revoked = append(revoked, g)
+	}
+	for _, name := range plan.Owned {
+		if err := s.repoMgr.SetOwner(name, ""); err != nil && !isNotFound(err) {
+			return revoked, err
+		}
+	}
+	return revoked, nil
+}
+
+// isNotFound reports whether err is about a repository that no longer
+// exists, which has taken its grants and owner with it
+func isNotFound(err error) bool {
+	var notFound *repo.NotFoundError
+	return errors.As(err, &notFound)
+}
+
+// SetOwner records a live user as the owner of a repository, empty clears it
+func (s *Service) SetOwner(repoName, userName string) error {
+	if userName != "" && s.authMgr.GetUser(userName) == nil {
+		return &auth.UserNotFoundError{Name: userName}
+	}
+	return s.repoMgr.SetOwner(repoName, userName)
+}
+
+// DanglingGrants returns grants that refer to users which no longer exist
+func (s *Service) DanglingGrants() []Grant {
+	return s.collectGrants(func(u string) bool {
+		return u != GuestUser && s.authMgr.GetUser(u) == nil
+	})
+}
+
+// FixDanglingGrants revokes all dangling grants and returns them
+func (s *Service) FixDanglingGrants() ([]Grant, error) {
+	grants := s.DanglingGrants()
+	for _, g := range grants {
+		if err := s.repoMgr.RemoveUser(g.Repo, g.User); err != nil {
+			return nil, err
+		}
+	}
+	return grants, nil
+}
+
+// CreateRepo creates a repository, seeded from a template unless templateName
+// is empty. Template grants that cannot be applied, for example because the
+// user does not exist, are skipped and returned as errors.
+func (s *Service) CreateRepo(repoName, templateName string) ([]error, error) {
+	if templateName == "" {
+		return nil, s.repoMgr.Create(repoName)
+	}
+
+	t, err := s.repoMgr.Template(templateName)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.repoMgr.CreateFromTemplate(repoName, t); err != nil {
+		return nil, err
+	}
+
+	users := make([]string, 0, len(t.Permissions))
+	for u := range t.Permissions {
+		users = append(users, u)
+	}
+	sort.Strings(users)
+
+	skipped := make([]error, 0)
+	for _, u := range users {
+		if err := s.GrantUser(repoName, u, t.Permissions[u]); err != nil {
+			skipped = append(skipped, err)
+		}
+	}
+	return skipped, nil
+}
+
+// ForkRepo forks a repository. Without an owner the grants of src are
+// copied; otherwise the owner becomes the only user, as its maintainer,
+// and the fork must fit into the owner's quota.
+func (s *Service) ForkRepo(src, dst, owner string) error {
+	if owner != "" {
+		user := s.authMgr.GetUser(owner)
+		if user == nil {
+			return &auth.UserNotFoundError{Name: owner}
+		}
+		if err := s.checkForkQuota(src, user); err != nil {
+			return err
+		}
+	}
+	if err := s.repoMgr.Fork(src, dst); err != nil {
+		return err
+	}
+
+	if owner != "" {
+		if err := s.repoMgr.SetOwner(dst, owner); err != nil {
+			return err
+		}
+		return s.repoMgr.AddUser(dst, owner, repo.PermMaintain)
+	}
+	for _, g := range s.collectGrants(func(string) bool { return true }) {
+		if g.Repo != src {
+			continue
+		}
+		if err := s.repoMgr.AddUser(dst, g.User, g.Perm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkForkQuota fails when a fork of src would take user over their quota,
+// which counts the fork at the full size of src like pushes do
+func (s *Service) checkForkQuota(src string, user *auth.User) error {
+	if user.Quota <= 0 {
+		return nil
+	}
+	size, err := s.repoMgr.Size(src)
+	if err != nil {
+		return err
+	}
+	usage, err := s.repoMgr.UserUsage(user.Name)
+	if err != nil {
+		return err
+	}
+	if usage+size > user.Quota {
+		return fmt.Errorf("user quota exceeded (%s used of %s, the fork needs %s)",
+			repo.FormatSize(usage), repo.FormatSize(user.Quota), repo.FormatSize(size))
+	}
+	return nil
+}
+
+// RestoreRepo restores a repository from the trash and revokes the grants
+// of users deleted since, which it returns
+func (s *Service) RestoreRepo(repoName string) ([]Grant, error) {
+	if err := s.repoMgr.Restore(repoName); err != nil {
+		return nil, err
+	}
+
+	revoked := make([]Grant, 0)
+	for _, g := range s.DanglingGrants() {
+		if g.Repo != repoName {
+			continue
+		}
+		if err := s.repoMgr.RemoveUser(g.Repo, g.User); err != nil {
+			return nil, err
+		}
+		revoked = append(revoked, g)
+	}
+	return revoked, nil
+}
+
+// collectGrants returns the grants whose username matches, sorted by repository
+func (s *Service) collectGrants(match func(userName string) bool) []Grant {
+	grants := make([]Grant, 0)
+	for repoName, users := range s.repoMgr.Grants() {
+		for u, p := range users {
+			if match(u) {
+				grants = append(grants, Grant{Repo: repoName, User: u, Perm: p})
+			}
+		}
+	}
+	sort.Slice(grants, func(i, j int) bool {
+		if grants[i].Repo != grants[j].Repo {
+			return grants[i].Repo < grants[j].Repo
+		}
+		return grants[i].User < grants[j].User
+	})
+	return grants
+}
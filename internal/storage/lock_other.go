@@ -0,0 +1,25 @@
+//go:build !unix
+
+package storage
+
+import "os"
+
+// lockFile reports whether f may be taken over. Without file locks the
+// process ID written in it is checked instead: the file is free when it
+// names no running process, or the current one, which a reused ID after a
+// restart can be.
+func lockFile(f *os.File) bool {
+	pid := readPID(f.Name())
+	return pid <= 0 || pid == os.Getpid() || !processAlive(pid)
+}
+
+// processAlive reports whether a process with the given ID exists. Finding
+// a process fails on these systems when it does not exist.
+func processAlive(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+	return true
+}
@@ -0,0 +1,90 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// PIDFile is the file inside the data directory holding the process ID of
+// the server using it
+const PIDFile = "gitlite.pid"
+
+var (
+	dataDirMu    sync.Mutex
+	dataDirFiles = make(map[string]*os.File) // Locked PID files kept open by this process, by path
+)
+
+// LockDataDir records the current process as the server using a data
+// directory. The PID file stays locked until UnlockDataDir or the process
+// exits, so a file left behind by a crash never blocks a restart.
+func LockDataDir(dataPath string) error {
+	path := filepath.Join(dataPath, PIDFile)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", PIDFile, err)
+	}
+	if !lockFile(f) {
+		f.Close()
+		return fmt.Errorf("data directory %s is in use by process %d", dataPath, readPID(path))
+	}
+	if err := f.Truncate(0); err == nil {
+		_, err = f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %v", PIDFile, err)
+	}
+
+	dataDirMu.Lock()
+	dataDirFiles[path] = f
+	dataDirMu.Unlock()
+	return nil
+}
+
+// UnlockDataDir releases a data directory locked by LockDataDir
+func UnlockDataDir(dataPath string) {
+	path := filepath.Join(dataPath, PIDFile)
+	dataDirMu.Lock()
+	f := dataDirFiles[path]
+	delete(dataDirFiles, path)
+	dataDirMu.Unlock()
+
+	if f != nil {
+		// The file is emptied rather than removed, so another process that
+		// opened it in the meantime still locks the same file
+		f.Truncate(0)
+		f.Close()
+	}
+}
+
+// DataDirOwner returns the ID of the running process using a data
+// directory, -1 if its ID cannot be read, or 0 if there is none
+func DataDirOwner(dataPath string) int {
+	path := filepath.Join(dataPath, PIDFile)
+	f, err := os.Open(path)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+	if lockFile(f) {
+		return 0
+	}
+	return readPID(path)
+}
+
+// readPID returns the process ID stored in a PID file, or -1
+func readPID(path string) int {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return -1
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil || pid <= 0 {
+		return -1
+	}
+	return pid
+}
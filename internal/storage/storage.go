@@ -4,14 +4,101 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"path/filepath"
+	"sync"
+	"time"
 
 	"golang.org/x/crypto/ssh"
 )
 
 // User represents a user with SSH keys for JSON persistence
 type User struct {
-	Name string   `json:"name"` // Unique username
-	Keys []string `json:"keys"` // SSH public key strings in authorized_keys format
+	Name  string   `json:"name"`            // Unique username
+	Keys  []Key    `json:"keys"`            // SSH public keys with their metadata
+	Quota int64    `json:"quota,omitempty"` // Total size of writable repositories in bytes, 0 means unlimited
+	Roles []string `json:"roles,omitempty"` // Roles beyond git access, such as "admin"
+	Lang  string   `json:"lang,omitempty"`  // Preferred language, empty follows the SSH locale
+}
+
+// Key represents an SSH public key with its metadata for JSON persistence.
+// Older data files store keys as plain authorized_keys strings, which are
+// still accepted when loading.
+type Key struct {
+	Key       string     `json:"key"`                  // SSH public key string in authorized_keys format
+	Comment   string     `json:"comment,omitempty"`    // Key label
+	AddedAt   *time.Time `json:"added_at,omitempty"`   // When the key was added
+	AddedBy   string     `json:"added_by,omitempty"`   // Administrator who added the key
+	LastUsed  *time.Time `json:"last_used,omitempty"`  // Last login with the key
+	LastIP    string     `json:"last_ip,omitempty"`    // Remote IP of the last login
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // Key is refused from this time on
+}
+
+// UnmarshalJSON accepts both the key object and the legacy plain string form
+func (k *Key) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		*k = Key{}
+		return json.Unmarshal(data, &k.Key)
+	}
+	type plain Key // Avoid recursing into this method
+	return json.Unmarshal(data, (*plain)(k))
+}
+
+// TimePtr returns nil for the zero time so it is omitted from JSON
+func TimePtr(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+// TimeValue dereferences an optional time, returning the zero time for nil
+func TimeValue(t *time.Time) time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return *t
+}
+
+// saveMu serializes saves, so concurrent saves of one file cannot
+// interleave and the last one started is the one that stays
+var saveMu sync.Mutex
+
+// writeFile replaces a file atomically: the data is written to a temporary
+// file next to it, flushed to disk and renamed into place, so a crash
+// leaves either the old or the new content
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	saveMu.Lock()
+	defer saveMu.Unlock()
+
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if err := f.Chmod(perm); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
 }
 
 // LoadUsers loads user data from a JSON file
@@ -43,7 +130,7 @@ func SaveUsers(path string, users []User) error {
 		return fmt.Errorf("failed to serialize user data: %v", err)
 	}
 
-	if err := os.WriteFile(path, jsonData, 0644); err != nil {
+	if err := writeFile(path, jsonData, 0644); err != nil {
 		return fmt.Errorf("failed to save user data: %v", err)
 	}
 
@@ -63,20 +150,41 @@ func LoadSSHKeys(keyStrs []string) []ssh.PublicKey {
 	return keys
 }
 
-// SaveSSHKeys converts ssh.PublicKey objects to strings for persistence
-func SaveSSHKeys(keys []ssh.PublicKey) []string {
-	keyStrs := make([]string, len(keys))
-	for i, k := range keys {
-		keyStrs[i] = string(ssh.MarshalAuthorizedKey(k))
-	}
-	return keyStrs
-}
-
 // RepoPermission represents repository permissions for JSON persistence
 type RepoPermission struct {
-	Name  string            `json:"name"`            // Repository name
-	Path  string            `json:"path"`            // Filesystem path to repository
-	Users map[string]string `json:"users"`           // Username to permission mapping ("r" or "rw")
+	Name        string                    `json:"name"`                    // Repository name
+	Path        string                    `json:"path"`                    // Filesystem path to repository
+	Users       map[string]string         `json:"users"`                   // Username to permission mapping ("r", "rw" or "maintain")
+	Quota       int64                     `json:"quota,omitempty"`         // Maximum on-disk size in bytes
+	MaxBlobSize int64                     `json:"max_blob_size,omitempty"` // Largest blob accepted on push in bytes
+	DeployKeys  []DeployKey               `json:"deploy_keys,omitempty"`   // Keys scoped to this repository
+	Aliases     []RepoAlias               `json:"aliases,omitempty"`       // Former names redirecting to this repository
+	Description string                    `json:"description,omitempty"`   // Free-form description
+	Owner       string                    `json:"owner,omitempty"`         // User responsible for the repository
+	Archived    bool                      `json:"archived,omitempty"`      // Whether the repository is read-only
+	LastPush    *time.Time                `json:"last_push,omitempty"`     // Time of the latest successful push
+	ForkOf      string                    `json:"fork_of,omitempty"`       // Repository this one was forked from
+	Maintenance map[string]MaintenanceRun `json:"maintenance,omitempty"`   // Latest result of each maintenance task
+}
+
+// MaintenanceRun represents the result of a maintenance task for JSON persistence
+type MaintenanceRun struct {
+	StartedAt  time.Time `json:"started_at"`        // Time the task started
+	DurationMs int64     `json:"duration_ms"`       // How long the task took in milliseconds
+	OK         bool      `json:"ok"`                // Whether the task succeeded
+	Message    string    `json:"message,omitempty"` // Last line of output of a failed task
+}
+
+// RepoAlias represents a former repository name for JSON persistence
+type RepoAlias struct {
+	Name      string    `json:"name"`       // Former repository name
+	ExpiresAt time.Time `json:"expires_at"` // Time the redirect ends
+}
+
+// DeployKey represents a repository scoped SSH key for JSON persistence
+type DeployKey struct {
+	Key  string `json:"key"`  // SSH public key string in authorized_keys format
+	Perm string `json:"perm"` // Permission ("r" or "rw")
 }
 
 // LoadRepoPermissions loads repository permission data from a JSON file
@@ -108,9 +216,169 @@ func SaveRepoPermissions(path string, repos []RepoPermission) error {
 		return fmt.Errorf("failed to serialize repo permission data: %v", err)
 	}
 
-	if err := os.WriteFile(path, jsonData, 0644); err != nil {
+	if err := writeFile(path, jsonData, 0644); err != nil {
 		return fmt.Errorf("failed to save repo permission data: %v", err)
 	}
 
 	return nil
 }
+
+// TrashEntry represents a deleted repository kept in the trash for JSON persistence
+type TrashEntry struct {
+	ID        string         `json:"id"`                   // Directory name inside the trash
+	DeletedAt time.Time      `json:"deleted_at"`           // Time of deletion
+	ExpiresAt *time.Time     `json:"expires_at,omitempty"` // Time after which it is purged, nil keeps it until purged manually
+	Repo      RepoPermission `json:"repo"`                 // Repository record at the time of deletion
+}
+
+// LoadTrash loads the trash index from a JSON file
+func LoadTrash(path string) ([]TrashEntry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil // Trash is empty
+		}
+		return nil, fmt.Errorf("failed to read trash index: %v", err)
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var entries []TrashEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse trash index: %v", err)
+	}
+
+	return entries, nil
+}
+
+// SaveTrash persists the trash index to a JSON file
+func SaveTrash(path string, entries []TrashEntry) error {
+	jsonData, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize trash index: %v", err)
+	}
+
+	if err := writeFile(path, jsonData, 0644); err != nil {
+		return fmt.Errorf("failed to save trash index: %v", err)
+	}
+
+	return nil
+}
+
+// TemplateConfig represents the optional template.json of a repository template
+type TemplateConfig struct {
+	Description   string            `json:"description"`    // Description given to new repositories
+	DefaultBranch string            `json:"default_branch"` // Branch HEAD points to and the initial commit goes to
+	Permissions   map[string]string `json:"permissions"`    // Username to permission mapping ("r", "rw" or "maintain")
+}
+
+// LoadTemplateConfig loads a template configuration from a JSON file
+func LoadTemplateConfig(path string) (*TemplateConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &TemplateConfig{}, nil // Configuration is optional
+		}
+		return nil, fmt.Errorf("failed to read template config: %v", err)
+	}
+
+	var cfg TemplateConfig
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse template config: %v", err)
+	}
+
+	return &cfg, nil
+}
+
+// APIToken represents a bearer token of the HTTP admin API for JSON persistence.
+// Only a hash of the secret is stored.
+type APIToken struct {
+	ID        string     `json:"id"`                   // Public part of the token, used to revoke it
+	Name      string     `json:"name"`                 // Label describing what the token is for
+	Hash      string     `json:"hash"`                 // Hex encoded SHA-256 of the secret
+	CreatedAt time.Time  `json:"created_at"`           // When the token was issued
+	CreatedBy string     `json:"created_by,omitempty"` // Administrator who issued the token
+	LastUsed  *time.Time `json:"last_used,omitempty"`  // Last request made with the token
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // Token is refused from this time on
+}
+
+// LoadTokens loads API tokens from a JSON file
+func LoadTokens(path string) ([]APIToken, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil // No token was issued yet
+		}
+		return nil, fmt.Errorf("failed to read token data: %v", err)
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var tokens []APIToken
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("failed to parse token data: %v", err)
+	}
+
+	return tokens, nil
+}
+
+// SaveTokens persists API tokens to a JSON file readable only by the owner
+func SaveTokens(path string, tokens []APIToken) error {
+	jsonData, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize token data: %v", err)
+	}
+
+	if err := writeFile(path, jsonData, 0600); err != nil {
+		return fmt.Errorf("failed to save token data: %v", err)
+	}
+
+	return nil
+}
+
+// Admin represents an administrator with SSH keys for JSON persistence
+type Admin struct {
+	Name string `json:"name"`           // Unique administrator name
+	Keys []Key  `json:"keys"`           // SSH public keys with their metadata
+	Lang string `json:"lang,omitempty"` // Preferred language, empty follows the SSH locale
+}
+
+// LoadAdmins loads administrators from a JSON file
+func LoadAdmins(path string) ([]Admin, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil // No administrator was added yet
+		}
+		return nil, fmt.Errorf("failed to read admin data: %v", err)
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+
+	var admins []Admin
+	if err := json.Unmarshal(data, &admins); err != nil {
+		return nil, fmt.Errorf("failed to parse admin data: %v", err)
+	}
+
+	return admins, nil
+}
+
+// SaveAdmins persists administrators to a JSON file
+func SaveAdmins(path string, admins []Admin) error {
+	jsonData, err := json.MarshalIndent(admins, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to serialize admin data: %v", err)
+	}
+
+	if err := writeFile(path, jsonData, 0644); err != nil {
+		return fmt.Errorf("failed to save admin data: %v", err)
+	}
+
+	return nil
+}
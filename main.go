@@ -20,6 +20,11 @@ func main() {
 	// Load configuration
 	cfg := config.Load()
 
+	// Subcommands run instead of the server
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(cfg, os.Args[1:]))
+	}
+
 	srv, err := server.New(cfg)
 	if err != nil {
 		logging.Get().Fatal("Failed to create server", zap.Error(err))